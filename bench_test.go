@@ -5,6 +5,8 @@ import (
 	"io"
 	"io/ioutil"
 	"math/rand"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -12,9 +14,10 @@ import (
 
 func BenchmarkDecode(b *testing.B) {
 	in := generateCSV()
+	b.ReportAllocs()
 	b.ResetTimer()
-	d := NewDecoder(in)
 	for i := 0; i < b.N; i++ {
+		d := NewDecoder(strings.NewReader(in))
 		var r struct{ A, B, C string }
 		for {
 			if err := d.DecodeNext(&r); err == io.EOF {
@@ -27,11 +30,37 @@ func BenchmarkDecode(b *testing.B) {
 	}
 }
 
+// BenchmarkDecode_Wide decodes into a struct with many tagged fields, most of
+// which aren't present in the input, to measure per-row struct overhead.
+func BenchmarkDecode_Wide(b *testing.B) {
+	in := generateCSV()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		d := NewDecoder(strings.NewReader(in))
+		var r struct {
+			A, B, C    string
+			D, E, F, G string
+			H, I, J, K int
+			L, M, N, O *bool `csv:",omitempty"`
+		}
+		for {
+			if err := d.DecodeNext(&r); err == io.EOF {
+				break
+			} else if err != nil {
+				b.Errorf("DecodeNext(%q): %v", in, err)
+				return
+			}
+		}
+	}
+}
+
 func BenchmarkCSVRead(b *testing.B) {
 	in := generateCSV()
+	b.ReportAllocs()
 	b.ResetTimer()
-	r := csv.NewReader(in)
 	for i := 0; i < b.N; i++ {
+		r := csv.NewReader(strings.NewReader(in))
 		if _, err := r.ReadAll(); err != nil {
 			b.Errorf("ReadAll(%q): %v", in, err)
 			return
@@ -45,6 +74,7 @@ func BenchmarkEncode(b *testing.B) {
 	for i := 0; i < numRows; i++ {
 		rows = append(rows, row{randString(), randString(), randString()})
 	}
+	b.ReportAllocs()
 	b.ResetTimer()
 
 	e := NewEncoder(ioutil.Discard)
@@ -58,11 +88,55 @@ func BenchmarkEncode(b *testing.B) {
 	}
 }
 
+// BenchmarkEncode_Flush compares flushing the Encoder after every row with
+// flushing it once per batch, writing to a file so that flushes are syscalls.
+func BenchmarkEncode_Flush(b *testing.B) {
+	type row struct{ A, B, C string }
+	rows := []row{}
+	for i := 0; i < numRows; i++ {
+		rows = append(rows, row{randString(), randString(), randString()})
+	}
+	for _, c := range []struct {
+		name   string
+		perRow bool
+	}{{"PerRow", true}, {"Batched", false}} {
+		b.Run(c.name, func(b *testing.B) {
+			f, err := os.Create(filepath.Join(b.TempDir(), "out.csv"))
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer f.Close()
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			e := NewEncoder(f)
+			for i := 0; i < b.N; i++ {
+				for _, r := range rows {
+					if err := e.EncodeNext(r); err != nil {
+						b.Errorf("EncodeNext(%v): %v", r, err)
+						return
+					}
+					if c.perRow {
+						if err := e.Flush(); err != nil {
+							b.Errorf("Flush(): %v", err)
+							return
+						}
+					}
+				}
+			}
+			if err := e.Close(); err != nil {
+				b.Errorf("Close(): %v", err)
+			}
+		})
+	}
+}
+
 func BenchmarkCSVWrite(b *testing.B) {
 	d := [][]string{}
 	for i := 0; i < numRows; i++ {
 		d = append(d, []string{randString(), randString(), randString()})
 	}
+	b.ReportAllocs()
 	b.ResetTimer()
 
 	w := csv.NewWriter(ioutil.Discard)
@@ -79,7 +153,7 @@ func BenchmarkCSVWrite(b *testing.B) {
 const (
 	alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 	strLen   = 5
-	numRows  = 10
+	numRows  = 1000
 )
 
 var r = rand.New(rand.NewSource(time.Now().Unix()))
@@ -93,10 +167,10 @@ func randString() string {
 }
 
 // TODO: Generate the CSV on-demand instead of cramming it all into memory
-func generateCSV() io.Reader {
+func generateCSV() string {
 	rs := []string{"A,B,C"}
 	for i := 0; i < numRows; i++ {
 		rs = append(rs, strings.Join([]string{randString(), randString(), randString()}, ","))
 	}
-	return strings.NewReader(strings.Join(rs, "\n"))
+	return strings.Join(rs, "\n")
 }
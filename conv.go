@@ -0,0 +1,146 @@
+package csvstruct
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// ParseFunc parses a cell value into a Go value.
+type ParseFunc func(s string) (interface{}, error)
+
+// FormatFunc formats a Go value as a cell value.
+type FormatFunc func(v interface{}) (string, error)
+
+// converter is a registered pair of ParseFunc and FormatFunc. Either may be
+// nil if the converter is only used for decoding or encoding.
+type converter struct {
+	parse  ParseFunc
+	format FormatFunc
+}
+
+// Converters holds custom conversions between cell values and Go values,
+// for types that don't implement encoding.TextMarshaler and
+// encoding.TextUnmarshaler.
+//
+// Registered conversions take precedence over all built-in conversions. The
+// zero value is an empty set of conversions, ready to use. A Converters may
+// be shared by Decoders and Encoders, but must not be modified while in use.
+type Converters struct {
+	types map[reflect.Type]converter
+	named map[string]converter
+}
+
+// RegisterType registers functions to convert values of type t.
+//
+// The conversion also applies to fields and map values of type *t; nil
+// pointers are encoded as empty cells.
+func (c *Converters) RegisterType(t reflect.Type, parse ParseFunc, format FormatFunc) {
+	if c.types == nil {
+		c.types = make(map[reflect.Type]converter)
+	}
+	c.types[t] = converter{parse, format}
+}
+
+// Register registers functions to convert values of fields tagged with the
+// option "conv=name".
+//
+// For pointer fields, the functions convert the value pointed to; nil
+// pointers are encoded as empty cells.
+func (c *Converters) Register(name string, parse ParseFunc, format FormatFunc) {
+	if c.named == nil {
+		c.named = make(map[string]converter)
+	}
+	c.named[name] = converter{parse, format}
+}
+
+// lookup returns the converter for values of type t, or for fields tagged
+// with the converter name conv, and whether the converter applies to t's
+// element type rather than t.
+func (c *Converters) lookup(t reflect.Type, conv string) (cv converter, elem bool, err error) {
+	if conv != "" {
+		if c != nil {
+			if cv, ok := c.named[conv]; ok {
+				return cv, t.Kind() == reflect.Ptr, nil
+			}
+		}
+		return converter{}, false, fmt.Errorf("unknown converter %q", conv)
+	}
+	if c == nil {
+		return converter{}, false, nil
+	}
+	if cv, ok := c.types[t]; ok {
+		return cv, false, nil
+	}
+	if t.Kind() == reflect.Ptr {
+		if cv, ok := c.types[t.Elem()]; ok {
+			return cv, true, nil
+		}
+	}
+	return converter{}, false, nil
+}
+
+// decodeFunc returns a decodeFunc for values of type t using the registered
+// converter, or nil if none applies.
+func (c *Converters) decodeFunc(t reflect.Type, conv string, omitempty bool) (decodeFunc, error) {
+	cv, elem, err := c.lookup(t, conv)
+	if err != nil || cv.parse == nil {
+		return nil, err
+	}
+	dt := t
+	if elem {
+		dt = t.Elem()
+	}
+	dec := func(v reflect.Value, s string) error {
+		x, err := cv.parse(s)
+		if err != nil {
+			return err
+		}
+		if elem {
+			if v.IsNil() {
+				v.Set(reflect.New(dt))
+			}
+			v = v.Elem()
+		}
+		if x == nil {
+			v.Set(reflect.Zero(dt))
+			return nil
+		}
+		xv := reflect.ValueOf(x)
+		if !xv.Type().AssignableTo(dt) {
+			if !xv.Type().ConvertibleTo(dt) {
+				return fmt.Errorf("converter returned %v, want %v", xv.Type(), dt)
+			}
+			xv = xv.Convert(dt)
+		}
+		v.Set(xv)
+		return nil
+	}
+	if omitempty {
+		return func(v reflect.Value, s string) error {
+			if s == "" {
+				v.Set(reflect.Zero(v.Type()))
+				return nil
+			}
+			return dec(v, s)
+		}, nil
+	}
+	return dec, nil
+}
+
+// encodeFunc returns an encodeFunc for values of type t using the registered
+// converter, or nil if none applies.
+func (c *Converters) encodeFunc(t reflect.Type, conv string) (encodeFunc, error) {
+	cv, elem, err := c.lookup(t, conv)
+	if err != nil || cv.format == nil {
+		return nil, err
+	}
+	return func(v reflect.Value) (string, error) {
+		if elem {
+			if v.IsNil() {
+				return "", nil
+			}
+			v = v.Elem()
+		}
+		return cv.format(v.Interface())
+	}, nil
+}
@@ -0,0 +1,139 @@
+package csvstruct
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// money is a third-party type that can't implement encoding.TextMarshaler.
+type money struct {
+	units int64
+	cur   string
+}
+
+func testConverters() *Converters {
+	var c Converters
+	c.RegisterType(reflect.TypeOf(money{}), func(s string) (interface{}, error) {
+		var m money
+		if _, err := fmt.Sscanf(s, "%d %s", &m.units, &m.cur); err != nil {
+			return nil, err
+		}
+		return m, nil
+	}, func(v interface{}) (string, error) {
+		m := v.(money)
+		return fmt.Sprintf("%d %s", m.units, m.cur), nil
+	})
+	c.Register("cents", func(s string) (interface{}, error) {
+		f, err := strconv.ParseFloat(s, 64)
+		return int64(f * 100), err
+	}, func(v interface{}) (string, error) {
+		return strconv.FormatFloat(float64(v.(int))/100, 'f', 2, 64), nil
+	})
+	return &c
+}
+
+type convRow struct {
+	Price  money
+	Ptr    *money
+	Amount int `csv:",conv=cents"`
+	Name   string
+}
+
+func TestConverters_Decode(t *testing.T) {
+	s := "Price,Ptr,Amount,Name\n100 USD,5 EUR,1.23,a"
+	d := NewDecoder(strings.NewReader(s)).Opts(DecodeOpts{Converters: testConverters()})
+	var r convRow
+	if err := d.DecodeNext(&r); err != nil {
+		t.Fatalf("DecodeNext(%q): %v", s, err)
+	}
+	want := convRow{money{100, "USD"}, &money{5, "EUR"}, 123, "a"}
+	if !reflect.DeepEqual(r, want) {
+		t.Errorf("DecodeNext(%q): got %v, want %v", s, r, want)
+	}
+
+	// Converter errors are reported as *DecodeError.
+	s = "Price\nfree"
+	d = NewDecoder(strings.NewReader(s)).Opts(DecodeOpts{Converters: testConverters()})
+	var de *DecodeError
+	if err := d.DecodeNext(&r); !errors.As(err, &de) || de.Field != "Price" {
+		t.Errorf("DecodeNext(%q): got %v, want *DecodeError for Price", s, err)
+	}
+
+	// Map values use registered types too.
+	s = "a,b\n1 USD,2 GBP"
+	d = NewDecoder(strings.NewReader(s)).Opts(DecodeOpts{Converters: testConverters()})
+	m := map[string]money{}
+	if err := d.DecodeNext(&m); err != nil {
+		t.Fatalf("DecodeNext(%q): %v", s, err)
+	}
+	if want := map[string]money{"a": {1, "USD"}, "b": {2, "GBP"}}; !reflect.DeepEqual(m, want) {
+		t.Errorf("DecodeNext(%q): got %v, want %v", s, m, want)
+	}
+}
+
+func TestConverters_Encode(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEncoder(&buf).Opts(EncodeOpts{Converters: testConverters()})
+	for _, r := range []convRow{
+		{money{100, "USD"}, &money{5, "EUR"}, 123, "a"},
+		{money{0, "JPY"}, nil, 5, "b"},
+	} {
+		if err := e.EncodeNext(r); err != nil {
+			t.Errorf("EncodeNext(%v): %v", r, err)
+		}
+	}
+	want := `Price,Ptr,Amount,Name
+100 USD,5 EUR,1.23,a
+0 JPY,,0.05,b
+`
+	if err := e.Flush(); err != nil {
+		t.Errorf("Flush(): %v", err)
+	}
+	if got := buf.String(); got != want {
+		t.Errorf("EncodeNext(): got %s, want %s", got, want)
+	}
+}
+
+func TestConverters_Unknown(t *testing.T) {
+	s := "Amount\n1.23"
+	var r convRow
+	if err := NewDecoder(strings.NewReader(s)).DecodeNext(&r); err == nil || !strings.Contains(err.Error(), `unknown converter "cents"`) {
+		t.Errorf("DecodeNext(%q): got %v, want unknown converter error", s, err)
+	}
+	if err := NewEncoder(&bytes.Buffer{}).EncodeNext(r); err == nil || !strings.Contains(err.Error(), `unknown converter "cents"`) {
+		t.Errorf("EncodeNext(%v): got %v, want unknown converter error", r, err)
+	}
+}
+
+func TestConverters_NamedPointer(t *testing.T) {
+	type row struct {
+		Amount *int `csv:",conv=cents"`
+	}
+	s := "Amount\n1.23\n"
+	var r row
+	if err := NewDecoder(strings.NewReader(s)).Opts(DecodeOpts{Converters: testConverters()}).DecodeNext(&r); err != nil {
+		t.Fatalf("DecodeNext(%q): %v", s, err)
+	}
+	if r.Amount == nil || *r.Amount != 123 {
+		t.Errorf("DecodeNext(%q): got %v, want 123", s, r.Amount)
+	}
+
+	var buf bytes.Buffer
+	e := NewEncoder(&buf).Opts(EncodeOpts{Converters: testConverters()})
+	for _, r := range []row{r, {}} {
+		if err := e.EncodeNext(r); err != nil {
+			t.Errorf("EncodeNext(%v): %v", r, err)
+		}
+	}
+	if err := e.Flush(); err != nil {
+		t.Errorf("Flush(): %v", err)
+	}
+	if got, want := buf.String(), s+"\n"; got != want {
+		t.Errorf("EncodeNext(): got %q, want %q", got, want)
+	}
+}
@@ -1,4 +1,61 @@
 // Package csvstruct provides methods to decode a CSV file into a struct.
+//
+// Struct fields are mapped to CSV columns by name. The "csv" struct tag can
+// override a field's column name and set options, separated by commas:
+//
+//	Field string    `csv:"-"`                     // ignored
+//	Field string    `csv:"name"`                  // mapped to column "name"
+//	Field string    `csv:"name,alias=a|b"`        // also decoded from column "a" or "b"
+//	Field string    `csv:"#3"`                    // decoded from the fourth column, encoded as "#3"
+//	Field string    `csv:"name,index=3"`          // decoded from the fourth column, encoded as "name"
+//	Field string    `csv:"name,order=1"`          // encoded before fields without order, or with greater order
+//	Field int       `csv:"name,omitempty"`        // empty cell when zero, and vice versa
+//	Field string    `csv:",required"`             // column must be in the header row
+//	Field Struct    `csv:",inline,prefix=field_"` // fields flattened into columns "field_..."
+//	Field Money     `csv:",conv=name"`            // converted by the Converters registered as "name"
+//	Field time.Time `csv:",layout=2006-01-02"`    // parsed and formatted with a layout
+//	Field time.Time `csv:",unixmilli,tz=UTC"`    // Unix timestamp in milliseconds, in UTC
+//	Field []string  `csv:"name,sep=|"`            // elements separated by "|" in one cell
+//	Field []int     `csv:"name,expand"`           // elements in columns "name_0", "name_1", ...
+//	Field int       `csv:"name,default=3"`        // 3 when the cell is empty or the column is missing
+//	Field int       `csv:"name,min=1,max=10"`     // decoding fails unless 1 <= Field <= 10
+//
+// Time layouts may also name a layout constant in package time, such as
+// "layout=RFC1123", and Unix timestamps may be in seconds ("unix"),
+// milliseconds ("unixmilli"), microseconds ("unixmicro") or nanoseconds
+// ("unixnano"). The "tz" option names a location as understood by
+// time.LoadLocation. Fields of type time.Duration are parsed with
+// time.ParseDuration and formatted with time.Duration.String.
+//
+// Slice and array elements are separated by commas unless "sep" says
+// otherwise, except that a []byte is the raw cell value. With "expand", the
+// Decoder reads numbered columns up to the first one missing from the header
+// row, and the Encoder writes a column for each element of the first value
+// encoded, or for N elements if "expand=N" is given.
+//
+// A "default" value, which can't contain commas, is decoded as if it were
+// the cell value, using any Format and Converters; a Decoder returns an error
+// before decoding any rows if it can't be.
+//
+// Decoded values are validated by the rules "min=N" and "max=N", which bound
+// numbers and the lengths of strings, slices and maps, "len=N", "oneof=a|b",
+// "regex=expr", "notempty", which fails for zero values and empty strings,
+// slices and maps, and "validate=name", which applies a custom rule
+// registered in DecodeOpts.Validators. A failed rule is reported as a
+// *ValidationError.
+//
+// Columns in the header row are matched to fields by name exactly, unless
+// DecodeOpts.HeaderMatch or DecodeOpts.NormalizeHeader say otherwise. A
+// field with aliases is decoded from whichever of its name and aliases is in
+// the header row, and a Decoder returns a *HeaderError if more than one is;
+// an Encoder always writes its name.
+//
+// Column indexes, given as "#N" or "index=N", start at 0 and take precedence
+// over names when decoding. With DecodeOpts.NoHeader, columns are named
+// "#0", "#1" and so on.
+//
+// Fields of embedded structs are promoted as if they were fields of the
+// enclosing struct, following the same rules as encoding/json.
 package csvstruct
 
 import (
@@ -7,9 +64,14 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"reflect"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
+	"unicode"
 )
 
 var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
@@ -21,7 +83,12 @@ type Decoder interface {
 	//
 	// On the first call to DecodeNext, the first row in the reader will be
 	// used as the header row to map CSV fields to struct fields, and the
-	// second row will be read to populate v.
+	// second row will be read to populate v, unless DecodeOpts.Header or
+	// DecodeOpts.NoHeader is set.
+	//
+	// DecodeNext returns io.EOF when there are no more rows. If there are
+	// no rows after the header row, decoding into a struct reports a
+	// *HeaderError or invalid struct tag instead.
 	DecodeNext(v interface{}) error
 
 	// Opts specifies options to modify decoding behavior.
@@ -36,11 +103,124 @@ type DecodeOpts struct {
 	Comment          rune // comment character for start of line
 	LazyQuotes       bool // allow lazy quotes
 	TrimLeadingSpace bool // trim leading space
+
+	// Infer specifies which types are inferred when decoding into a
+	// map[string]interface{}. The zero value infers all supported types.
+	Infer Inference
+
+	// CollectErrors causes every cell in a row to be decoded even if some
+	// fail, and all failures to be returned together as DecodeErrors.
+	CollectErrors bool
+
+	// StrictHeader causes decoding into a struct to fail if the header row
+	// has columns that don't map to any of the struct's fields. Columns
+	// claimed by Marshaler fields, or declared by ColumnUnmarshaler fields,
+	// map to those fields.
+	//
+	// Regardless of StrictHeader, decoding into a struct fails if the
+	// header row is missing a column for a field tagged "required".
+	StrictHeader bool
+
+	// Converters holds custom conversions from cell values, which take
+	// precedence over built-in conversions.
+	Converters *Converters
+
+	// Format specifies how booleans, nulls and numbers are represented in
+	// cells.
+	Format Format
+
+	// Validators holds custom validation rules for fields tagged with
+	// "validate=name".
+	Validators *Validators
+
+	// HeaderMatch specifies how columns in the header row are matched to
+	// struct fields. The zero value matches column names exactly.
+	HeaderMatch HeaderMatch
+
+	// NormalizeHeader, if non-nil, is applied to every column in the
+	// header row, and to the column names of struct fields before they're
+	// matched to them. Maps are decoded with the normalized column names
+	// as keys.
+	NormalizeHeader func(string) string
+
+	// Header, if non-nil, is used as the header row, and every row read
+	// is decoded as data.
+	Header []string
+
+	// NoHeader causes every row read to be decoded as data, with columns
+	// named by their indexes, as "#0", "#1" and so on. Struct fields are
+	// then mapped to columns by their "index" options.
+	NoHeader bool
+}
+
+// HeaderMatch specifies how columns in the header row are matched to struct
+// fields when decoding.
+type HeaderMatch uint8
+
+const (
+	MatchIgnoreCase       HeaderMatch = 1 << iota // names are compared case-insensitively
+	MatchIgnoreSeparators                         // white space, '_' and '-' in names are ignored
+	MatchStripBOM                                 // a byte order mark before the first column is removed
+
+	// MatchLoose enables all supported matching modes, so that "First Name",
+	// "first_name" and "FIRST-NAME" all match a field named FirstName.
+	MatchLoose = MatchIgnoreCase | MatchIgnoreSeparators | MatchStripBOM
+)
+
+// key returns the name, as normalized by m, by which it's matched to other
+// names.
+func (m HeaderMatch) key(name string) string {
+	if m&MatchIgnoreSeparators != 0 {
+		name = strings.Map(func(r rune) rune {
+			if unicode.IsSpace(r) || r == '_' || r == '-' {
+				return -1
+			}
+			return r
+		}, name)
+	}
+	if m&MatchIgnoreCase != 0 {
+		name = strings.ToLower(name)
+	}
+	return name
 }
 
+// Inference specifies which Go types cell values are converted to when
+// decoding into a map[string]interface{}.
+//
+// Types are tried in the order int64, float64, bool, time.Time; values that
+// can't be parsed as any enabled type are decoded as strings. Numbers with
+// leading zeros, such as zip codes, are never inferred, so that no digits
+// are lost.
+type Inference uint8
+
+const (
+	InferInt   Inference = 1 << iota // int64, parsed with strconv.ParseInt
+	InferFloat                       // finite float64, parsed with strconv.ParseFloat
+	InferBool                        // bool, from "true" or "false"
+	InferTime                        // time.Time, parsed as RFC 3339
+	InferNone                        // no inference; all values are strings
+
+	// InferAll infers all supported types.
+	InferAll = InferInt | InferFloat | InferBool | InferTime
+)
+
 type decoder struct {
-	r  csv.Reader
-	hm map[string]int
+	r       csv.Reader
+	header  []string
+	hm      map[string]int   // column indexes by name
+	cols    map[string]int   // column indexes by match key
+	dups    map[string][]int // indexes of distinctly named columns sharing a match key
+	match   HeaderMatch
+	norm    func(string) string
+	fixed   []string // header row given by DecodeOpts.Header
+	noHead  bool
+	infer   Inference
+	collect bool
+	strict  bool
+	conv    *Converters
+	format  *Format // nil if the zero Format
+	valid   *Validators
+	plans   map[reflect.Type]structPlan
 }
 
 // NewDecoder returns a Decoder that reads from r.
@@ -58,12 +238,32 @@ func (d *decoder) Opts(opts DecodeOpts) Decoder {
 	}
 	d.r.LazyQuotes = opts.LazyQuotes
 	d.r.TrimLeadingSpace = opts.TrimLeadingSpace
+	d.infer = opts.Infer
+	d.collect = opts.CollectErrors
+	d.strict = opts.StrictHeader
+	d.conv = opts.Converters
+	d.format = nil
+	if !opts.Format.isZero() {
+		d.format = &opts.Format
+	}
+	d.valid = opts.Validators
+	d.match = opts.HeaderMatch
+	d.norm = opts.NormalizeHeader
+	d.fixed = opts.Header
+	d.noHead = opts.NoHeader
 	return d
 }
 
 func (d *decoder) DecodeNext(v interface{}) error {
 	line, err := d.read()
-	if err != nil {
+	if errors.Is(err, io.EOF) && v != nil {
+		if rt := reflect.TypeOf(v); rt.Kind() == reflect.Ptr {
+			if perr := d.checkEmpty(rt.Elem()); perr != nil {
+				return perr
+			}
+		}
+		return err
+	} else if err != nil {
 		return err
 	}
 
@@ -76,136 +276,459 @@ func (d *decoder) DecodeNext(v interface{}) error {
 	if rv.Kind() != reflect.Ptr {
 		return errors.New("must be pointer")
 	}
-	rv = rv.Elem()
+	return d.decodeValue(rv.Elem(), line)
+}
 
-	switch rv.Type().Kind() {
+// decodeValue decodes line into rv, which must be a settable struct or map.
+func (d *decoder) decodeValue(rv reflect.Value, line []string) error {
+	switch rv.Kind() {
 	case reflect.Map:
-		return d.decodeMap(v, line)
+		return d.decodeMap(rv, line)
 	case reflect.Struct:
-		return d.decodeStruct(v, line)
+		return d.decodeStruct(rv, line)
 	default:
 		return errors.New("must be pointer to struct")
 	}
 }
-func (d *decoder) decodeMap(v interface{}, line []string) error {
+
+// DecodeAll decodes every row read from r into v, which must be a pointer to
+// a slice of structs or maps, or of pointers to them.
+//
+// The slice is truncated before rows are appended to it. Reaching the end of
+// the input is not considered an error. To decode with DecodeOpts, use
+// TypedDecoder.All.
+func DecodeAll(r io.Reader, v interface{}) error {
+	return NewDecoder(r).(*decoder).decodeAll(v)
+}
+
+// decodeAll decodes every remaining row into v, as described by DecodeAll.
+//
+// If DecodeOpts.CollectErrors is set, rows that fail to decode are left out
+// of the slice, and the failures of every row are returned together as
+// DecodeErrors once the end of the input is reached.
+func (d *decoder) decodeAll(v interface{}) error {
 	rv := reflect.ValueOf(v)
-	t := rv.Elem().Type()
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Slice {
+		return errors.New("must be pointer to slice")
+	}
+	sv := rv.Elem()
+	et := sv.Type().Elem()
+	isPtr := et.Kind() == reflect.Ptr
+	if isPtr {
+		et = et.Elem()
+	}
+	var decode func(reflect.Value, []string) error
+	switch et.Kind() {
+	case reflect.Map:
+		decode = d.decodeMap
+	case reflect.Struct:
+		decode = d.decodeStruct
+	default:
+		return errors.New("must be pointer to slice of structs or maps")
+	}
+
+	sv.SetLen(0)
+	var errs DecodeErrors
+	for {
+		line, err := d.read()
+		if errors.Is(err, io.EOF) {
+			if len(errs) != 0 {
+				return errs
+			}
+			return d.checkEmpty(et)
+		} else if err != nil {
+			return err
+		}
+		ev := reflect.New(et)
+		if err := decode(ev.Elem(), line); err != nil {
+			if des, ok := err.(DecodeErrors); ok && d.collect {
+				errs = append(errs, des...)
+				continue
+			}
+			return err
+		}
+		if !isPtr {
+			ev = ev.Elem()
+		}
+		sv.Set(reflect.Append(sv, ev))
+	}
+}
+
+func (d *decoder) decodeMap(rv reflect.Value, line []string) error {
+	t := rv.Type()
 	if t.Key().Kind() != reflect.String {
 		return errors.New("map key must be string")
 	}
-	switch t.Elem().Kind() {
-	case reflect.String:
-		m := *(v.(*map[string]string))
+	if rv.IsNil() {
+		rv.Set(reflect.MakeMapWithSize(t, len(d.hm)))
+	}
+	et := t.Elem()
+	if et.Kind() == reflect.Interface {
+		if et.NumMethod() != 0 {
+			return fmt.Errorf("can't decode type %v", et)
+		}
 		for hv, hidx := range d.hm {
-			m[hv] = line[hidx]
+			ev := reflect.Zero(et)
+			if !d.format.isNull(line[hidx]) {
+				ev = reflect.ValueOf(infer(d.infer, line[hidx]))
+			}
+			rv.SetMapIndex(reflect.ValueOf(hv).Convert(t.Key()), ev)
 		}
-	// TODO: Support arbitrary map values by parsing string values
-	case reflect.Interface:
-		return errors.New("TODO")
-	default:
-		return fmt.Errorf("can't decode type %v", t.Elem().Kind())
+		return nil
+	}
+	if err := d.format.validate(); err != nil {
+		return err
+	}
+	decode, err := d.conv.decodeFunc(et, "", false)
+	if err != nil {
+		return err
+	} else if decode == nil {
+		if decode, err = newDecodeFunc(et, nil, d.format); err != nil {
+			return err
+		}
+	}
+	decode = d.format.decodeNull(decode)
+	var errs DecodeErrors
+	for hv, hidx := range d.hm {
+		ev := reflect.New(et).Elem()
+		if err := decode(ev, line[hidx]); err != nil {
+			de := d.decodeError(line, hidx, hv, "", err)
+			if !d.collect {
+				return de
+			}
+			errs = append(errs, de)
+			continue
+		}
+		rv.SetMapIndex(reflect.ValueOf(hv).Convert(t.Key()), ev)
+	}
+	if len(errs) != 0 {
+		sort.Slice(errs, func(i, j int) bool { return errs[i].Column < errs[j].Column })
+		return errs
 	}
 	return nil
 }
 
-func (d *decoder) decodeStruct(v interface{}, line []string) error {
-	rv := reflect.ValueOf(v).Elem()
-	t := rv.Type()
-	for i := 0; i < t.NumField(); i++ {
-		f := t.Field(i)
-		if f.Anonymous {
+func (d *decoder) decodeStruct(rv reflect.Value, line []string) error {
+	p := d.plan(rv.Type())
+	if p.err != nil {
+		return p.err
+	}
+	var errs DecodeErrors
+	for _, f := range p.fields {
+		if f.col < 0 && !f.unmarshal && !f.expand && !f.hasDef {
+			// Field is only bound to encode it.
 			continue
 		}
-		n := f.Name
-		omitempty := false
-		if tag := f.Tag.Get("csv"); tag != "" {
-			parts := strings.Split(tag, ",")
-			if tagn := parts[0]; tag == "-" {
-				continue
-			} else if tagn != "" {
-				n = tagn
+		var err error
+		col, header := f.col, f.name
+		if col >= 0 {
+			// Column may be one of the field's aliases.
+			header = d.header[col]
+		}
+		fv := fieldByIndex(rv, f.index, true)
+		if f.unmarshal {
+			err = unmarshalCSV(fv, header, Row{d.header, line, d.cols, d.key})
+		} else if f.expand {
+			if col, err = decodeExpanded(fv, line, f.cols, f.decode); err != nil {
+				header = d.header[col]
+			}
+		} else if f.col >= 0 {
+			err = f.decode(fv, line[f.col])
+		} else {
+			err = f.decode(fv, f.def)
+		}
+		if err == nil {
+			err = validate(f.rules, fv)
+		}
+		if err != nil {
+			de := d.decodeError(line, col, header, f.fieldName, err)
+			if !d.collect {
+				return de
 			}
-			omitempty = len(parts) > 1 && parts[1] == "omitempty"
+			errs = append(errs, de)
 		}
-		idx, ok := d.hm[n]
-		if !ok {
-			// Unmapped header value
+	}
+	if len(errs) != 0 {
+		return errs
+	}
+	return nil
+}
+
+// plan returns the fields of struct type t that are mapped to a column in the
+// header row.
+func (d *decoder) plan(t reflect.Type) structPlan {
+	if p, ok := d.plans[t]; ok {
+		return p
+	}
+	var p structPlan
+	p.fields, p.err = bindFields(t, d, d.conv, d.format)
+	if p.err == nil {
+		p.err = d.checkHeader(t)
+	}
+	if p.err == nil {
+		p.err = d.bindRules(p.fields)
+	}
+	if d.plans == nil {
+		d.plans = make(map[reflect.Type]structPlan)
+	}
+	d.plans[t] = p
+	return p
+}
+
+// checkEmpty returns the error decoding rows into t would return, if the
+// input had a header row but ended before any row was decoded into t, so that
+// header errors and invalid tags aren't hidden by io.EOF.
+func (d *decoder) checkEmpty(t reflect.Type) error {
+	if d.hm == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+	if _, ok := d.plans[t]; ok {
+		return nil
+	}
+	return d.plan(t).err
+}
+
+// bindRules sets the validation rules of fields, including custom rules
+// registered in the Decoder's Validators.
+func (d *decoder) bindRules(fields []boundField) error {
+	for i := range fields {
+		f := &fields[i]
+		f.rules = f.field.rules
+		if f.validators == "" {
 			continue
 		}
-		strv := line[idx]
-		vf := rv.FieldByName(f.Name)
-		if vf.CanSet() {
-			if vf.CanInterface() && vf.Type().Implements(textUnmarshalerType) {
-				if vf.IsNil() {
-					vf.Set(reflect.New(vf.Type().Elem()))
+		custom, err := d.valid.lookup(f.validators)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", f.fieldName, err)
+		}
+		f.rules = append(f.rules[:len(f.rules):len(f.rules)], custom...)
+	}
+	return nil
+}
+
+// checkHeader returns a *HeaderError if the header row is missing columns
+// required by struct type t, by name or index, has several columns for the
+// same field of t under its name and aliases, or, if StrictHeader is set, has
+// columns that don't map to any of t's fields.
+func (d *decoder) checkHeader(t reflect.Type) error {
+	var herr HeaderError
+	known := map[string]bool{}
+	fields := cachedFields(t)
+	for i, f := range fields {
+		var found []int // indexes of columns matching the field's name or aliases
+		add := func(cols ...int) {
+			for _, col := range cols {
+				if !slices.Contains(found, col) {
+					found = append(found, col)
 				}
-				if tu, ok := vf.Interface().(encoding.TextUnmarshaler); ok {
-					if err := tu.UnmarshalText([]byte(strv)); err != nil {
-						return err
+			}
+		}
+		if col, ok := d.position(f.pos); f.pos >= 0 && ok {
+			known[d.match.key(d.header[col])] = true
+			add(col)
+		} else {
+			for _, name := range f.names() {
+				if f.expand {
+					// Numbered columns after a gap aren't decoded,
+					// so they're unknown.
+					for _, col := range expandColumns(name, d) {
+						known[d.match.key(d.header[col])] = true
 					}
-					continue
+					name = expandColumn(name, 0)
 				} else {
-					panic("unreachable")
-				}
-			}
-			if vf.Kind() == reflect.Ptr {
-				if omitempty && strv == "" {
-					continue
+					known[d.key(name)] = true
 				}
-				if vf.IsNil() {
-					vf.Set(reflect.New(vf.Type().Elem()))
+				if dups, ok := d.dups[d.key(name)]; ok {
+					add(dups...)
+				} else if col, ok := d.column(name); ok {
+					add(col)
 				}
-				vf = vf.Elem()
 			}
-
-			switch vf.Kind() {
-			case reflect.String:
-				vf.SetString(strv)
-			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-				i, err := strconv.ParseInt(strv, 10, 64)
-				if err != nil {
-					return fmt.Errorf("error decoding: %v", err)
-				}
-				vf.SetInt(i)
-			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-				u, err := strconv.ParseUint(strv, 10, 64)
-				if err != nil {
-					return fmt.Errorf("error decoding: %v", err)
-				}
-				vf.SetUint(u)
-			case reflect.Float64:
-				f, err := strconv.ParseFloat(strv, 64)
-				if err != nil {
-					return fmt.Errorf("error decoding: %v", err)
-				}
-				vf.SetFloat(f)
-			case reflect.Bool:
-				b, err := strconv.ParseBool(strv)
-				if err != nil {
-					return fmt.Errorf("error decoding: %v", err)
-				}
-				vf.SetBool(b)
-			default:
-				return fmt.Errorf("can't decode type %v", vf.Type())
+		}
+		if len(found) == 0 && f.required {
+			if f.expand {
+				herr.Missing = append(herr.Missing, expandColumn(f.name, 0))
+			} else {
+				herr.Missing = append(herr.Missing, f.name)
+			}
+		} else if len(found) > 1 {
+			for _, col := range found {
+				herr.Ambiguous = append(herr.Ambiguous, d.header[col])
 			}
 		}
+		if f.marshal && !f.expand && d.strict {
+			// Columns claimed by Marshalers are also known.
+			cols, err := marshalColumns(reflect.New(t).Elem(), &fields[i])
+			if err != nil {
+				return err
+			}
+			for _, c := range cols {
+				known[d.key(c)] = true
+			}
+		}
+		if f.unmarshal && !f.expand && d.strict {
+			// So are columns declared by ColumnUnmarshalers.
+			for _, c := range unmarshalColumns(&fields[i]) {
+				known[d.key(c)] = true
+			}
+		}
+	}
+	if d.strict {
+		for _, h := range d.header {
+			if !known[d.match.key(h)] {
+				herr.Unknown = append(herr.Unknown, h)
+			}
+		}
+	}
+	if len(herr.Missing) != 0 || len(herr.Unknown) != 0 || len(herr.Ambiguous) != 0 {
+		return &herr
 	}
 	return nil
 }
 
+// infer returns strv converted to the first type enabled in p that can
+// represent it, or strv itself if no such type exists.
+func infer(p Inference, strv string) interface{} {
+	if p == 0 {
+		p = InferAll
+	}
+	if p&InferNone != 0 {
+		return strv
+	}
+	if p&(InferInt|InferFloat) != 0 && !hasLeadingZero(strv) {
+		if p&InferInt != 0 {
+			if i, err := strconv.ParseInt(strv, 10, 64); err == nil {
+				return i
+			}
+		}
+		if p&InferFloat != 0 {
+			if f, err := strconv.ParseFloat(strv, 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+				return f
+			}
+		}
+	}
+	if p&InferBool != 0 {
+		if strv == "true" || strv == "false" {
+			return strv == "true"
+		}
+	}
+	if p&InferTime != 0 {
+		if t, err := time.Parse(time.RFC3339Nano, strv); err == nil {
+			return t
+		}
+	}
+	return strv
+}
+
+// hasLeadingZero reports whether the number in s, after any sign, starts
+// with a zero that isn't followed by a decimal point, as in "007" or "0x1F".
+func hasLeadingZero(s string) bool {
+	s = strings.TrimLeft(s, "+-")
+	return len(s) > 1 && s[0] == '0' && s[1] != '.'
+}
+
+// decodeError returns a *DecodeError describing a failure to decode column col
+// of the most recently read line.
+//
+// If col is negative, the error isn't associated with a particular column.
+func (d *decoder) decodeError(line []string, col int, header, field string, err error) *DecodeError {
+	if col < 0 {
+		l, _ := d.r.FieldPos(0)
+		return &DecodeError{Line: l, Header: header, Field: field, Err: err}
+	}
+	l, _ := d.r.FieldPos(col)
+	return &DecodeError{
+		Line:   l,
+		Column: col + 1,
+		Header: header,
+		Field:  field,
+		Value:  line[col],
+		Err:    err,
+	}
+}
+
 func (d *decoder) read() ([]string, error) {
 	if d.hm == nil {
-		// First run; read header row
-		header, err := d.r.Read()
-		if err != nil {
-			return nil, fmt.Errorf("error reading headers: %v", err)
+		switch {
+		case d.fixed != nil:
+			// Rows must have a cell for every column, as if the
+			// header row had been read.
+			d.r.FieldsPerRecord = len(d.fixed)
+			d.setHeader(slices.Clone(d.fixed))
+		case d.noHead:
+			line, err := d.r.Read()
+			if err != nil {
+				return nil, err
+			}
+			header := make([]string, len(line))
+			for i := range header {
+				header[i] = "#" + strconv.Itoa(i)
+			}
+			d.setHeader(header)
+			return line, nil
+		default:
+			// First run; read header row
+			header, err := d.r.Read()
+			if err != nil {
+				return nil, fmt.Errorf("error reading headers: %w", err)
+			}
+			d.setHeader(header)
 		}
-		d.hm = reverse(header)
 	}
 	// Read data row into []string
 	return d.r.Read()
 }
 
+// setHeader normalizes and sets the header row that columns are mapped by.
+func (d *decoder) setHeader(header []string) {
+	if d.match&MatchStripBOM != 0 && len(header) != 0 {
+		header[0] = strings.TrimPrefix(header[0], "\uFEFF")
+	}
+	if d.norm != nil {
+		for i, h := range header {
+			header[i] = d.norm(h)
+		}
+	}
+	d.header = header
+	d.hm = reverse(header)
+	d.cols = make(map[string]int, len(header))
+	d.dups = nil
+	for i, h := range header {
+		k := d.match.key(h)
+		if j, ok := d.cols[k]; ok && header[j] != h {
+			if d.dups == nil {
+				d.dups = make(map[string][]int)
+			}
+			if len(d.dups[k]) == 0 {
+				d.dups[k] = []int{j}
+			}
+			d.dups[k] = append(d.dups[k], i)
+		}
+		d.cols[k] = i
+	}
+}
+
+// key returns the key in d.cols of the column that name matches.
+func (d *decoder) key(name string) string {
+	if d.norm != nil {
+		name = d.norm(name)
+	}
+	return d.match.key(name)
+}
+
+// column returns the index of the column that name matches, and whether the
+// header row has such a column.
+func (d *decoder) column(name string) (int, bool) {
+	col, ok := d.cols[d.key(name)]
+	return col, ok
+}
+
+// position returns the index of the column at position i, and whether rows
+// have such a column.
+func (d *decoder) position(i int) (int, bool) {
+	return i, i < len(d.header)
+}
+
 func reverse(in []string) map[string]int {
 	m := make(map[string]int, len(in))
 	for i, v := range in {
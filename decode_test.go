@@ -1,12 +1,16 @@
 package csvstruct
 
 import (
+	"encoding/csv"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"reflect"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
 var ip = net.IPv4(128, 0, 0, 1)
@@ -88,6 +92,27 @@ func TestDecode_Tags(t *testing.T) {
 	}
 }
 
+func TestDecode_OmitEmpty(t *testing.T) {
+	type row struct {
+		Name  string `csv:"name,omitempty"`
+		Count int    `csv:"count,omitempty"`
+		Ptr   *int   `csv:"ptr,omitempty"`
+	}
+	s := "name,count,ptr\nbob,5,1\n,,"
+	d := NewDecoder(strings.NewReader(s))
+	var r row
+	if err := d.DecodeNext(&r); err != nil {
+		t.Fatalf("DecodeNext(%q): %v", s, err)
+	}
+	// Empty cells reset values left over from the previous row.
+	if err := d.DecodeNext(&r); err != nil {
+		t.Fatalf("DecodeNext(%q): %v", s, err)
+	}
+	if want := (row{}); r != want {
+		t.Errorf("DecodeNext(%q): got %+v, want %+v", s, r, want)
+	}
+}
+
 func TestDecode_NonStrings(t *testing.T) {
 	s := "Int,Int64,Uint64,Float64,Bool\n123,-123456789,123456789,123.456,true"
 	type row struct {
@@ -107,6 +132,48 @@ func TestDecode_NonStrings(t *testing.T) {
 	}
 }
 
+func TestDecode_Numeric(t *testing.T) {
+	s := "Int8,Uint16,Uintptr,Float32,Complex64,Complex128\n-128,65535,42,0.1,1-2i,(0.5+1.5i)"
+	type row struct {
+		Int8       int8
+		Uint16     uint16
+		Uintptr    uintptr
+		Float32    float32
+		Complex64  complex64
+		Complex128 complex128
+	}
+	var r row
+	if err := NewDecoder(strings.NewReader(s)).DecodeNext(&r); err != nil {
+		t.Errorf("DecodeNext(%q): %v", s, err)
+	}
+	want := row{-128, 65535, 42, 0.1, complex(1, -2), complex(0.5, 1.5)}
+	if r != want {
+		t.Errorf("DecodeNext(%q): got %v, want %v", s, r, want)
+	}
+}
+
+func TestDecode_Overflow(t *testing.T) {
+	for _, c := range []struct {
+		s string
+		v interface{}
+	}{
+		{"V\n300", &struct{ V int8 }{}},
+		{"V\n-129", &struct{ V int8 }{}},
+		{"V\n70000", &struct{ V uint16 }{}},
+		{"V\n-1", &struct{ V uint }{}},
+		{"V\n1e39", &struct{ V float32 }{}},
+		{"V\n2147483648", &struct{ V *int32 }{}},
+	} {
+		err := NewDecoder(strings.NewReader(c.s)).DecodeNext(c.v)
+		if err == nil {
+			t.Errorf("DecodeNext(%q): expected error, got %v", c.s, c.v)
+		}
+	}
+	if err := NewDecoder(strings.NewReader("V\n300")).DecodeNext(&struct{ V int8 }{}); !errors.Is(err, strconv.ErrRange) {
+		t.Errorf("DecodeNext: got %v, want strconv.ErrRange", err)
+	}
+}
+
 func TestDecode_IncompatibleTypes(t *testing.T) {
 	// Attempting to parse a string as an int will fail in strconv
 	s := "Int\nfoo"
@@ -114,11 +181,358 @@ func TestDecode_IncompatibleTypes(t *testing.T) {
 		Int int
 	}
 	var r row
-	if err := NewDecoder(strings.NewReader(s)).DecodeNext(&r); err.Error() != "error decoding: strconv.ParseInt: parsing \"foo\": invalid syntax" {
+	if err := NewDecoder(strings.NewReader(s)).DecodeNext(&r); err.Error() != "error decoding line 2, column 1 (\"Int\") into field Int: strconv.ParseInt: parsing \"foo\": invalid syntax" {
 		t.Errorf("DecodeNext(%q): %v", s, err)
 	}
 }
 
+func TestDecode_Required(t *testing.T) {
+	type row struct {
+		Foo string `csv:"foo,required"`
+		Bar string `csv:"bar,omitempty,required"`
+		Baz string `csv:"baz"`
+	}
+	for _, c := range []struct {
+		s      string
+		strict bool
+		want   string
+	}{{
+		"foo,bar,baz\na,b,c", false, "",
+	}, {
+		"foo,bar,qux\na,b,c", false, "",
+	}, {
+		"foo,bar\na,b", true, "",
+	}, {
+		"baz,qux\na,b", false, `invalid header row: missing required columns "foo", "bar"`,
+	}, {
+		"foo,qux,bar,quux\na,b,c,d", true, `invalid header row: unknown columns "qux", "quux"`,
+	}, {
+		"baz,qux\na,b", true, `invalid header row: missing required columns "foo", "bar"; unknown columns "qux"`,
+	}, {
+		// Header rows are checked even without data rows.
+		"baz", false, `invalid header row: missing required columns "foo", "bar"`,
+	}, {
+		"foo,bar,qux\n", true, `invalid header row: unknown columns "qux"`,
+	}} {
+		d := NewDecoder(strings.NewReader(c.s)).Opts(DecodeOpts{StrictHeader: c.strict})
+		var r row
+		err := d.DecodeNext(&r)
+		if c.want == "" {
+			if err != nil {
+				t.Errorf("DecodeNext(%q): %v", c.s, err)
+			}
+			continue
+		}
+		var herr *HeaderError
+		if !errors.As(err, &herr) {
+			t.Errorf("DecodeNext(%q): got %v, want *HeaderError", c.s, err)
+		} else if got := err.Error(); got != c.want {
+			t.Errorf("DecodeNext(%q): got %q, want %q", c.s, got, c.want)
+		}
+	}
+
+	// A valid header row without data rows is the end of the input.
+	s := "foo,bar"
+	if err := NewDecoder(strings.NewReader(s)).DecodeNext(&row{}); err != io.EOF {
+		t.Errorf("DecodeNext(%q): got %v, want io.EOF", s, err)
+	}
+	var herr *HeaderError
+	if err := DecodeAll(strings.NewReader("baz"), &[]row{}); !errors.As(err, &herr) {
+		t.Errorf("DecodeAll(%q): got %v, want *HeaderError", "baz", err)
+	}
+	if _, err := NewTypedDecoder[*row](strings.NewReader("baz")).Next(); !errors.As(err, &herr) {
+		t.Errorf("Next(%q): got %v, want *HeaderError", "baz", err)
+	}
+
+	// Decoding into a map doesn't check the header row.
+	m := map[string]string{}
+	if err := NewDecoder(strings.NewReader("a\nb")).Opts(DecodeOpts{StrictHeader: true}).DecodeNext(&m); err != nil {
+		t.Errorf("DecodeNext: %v", err)
+	}
+}
+
+func TestDecode_HeaderMatch(t *testing.T) {
+	type row struct {
+		FirstName string
+		LastName  string `csv:"last_name"`
+		Tags      []int  `csv:"tags,expand"`
+	}
+	for _, c := range []struct {
+		s     string
+		match HeaderMatch
+		want  row
+	}{{
+		"FirstName,last_name,tags_0\nAnn,Lee,1", 0, row{"Ann", "Lee", []int{1}},
+	}, {
+		"FIRSTNAME,Last_Name,TAGS_0\nAnn,Lee,1", 0, row{},
+	}, {
+		"FIRSTNAME,Last_Name,TAGS_0\nAnn,Lee,1", MatchIgnoreCase, row{"Ann", "Lee", []int{1}},
+	}, {
+		"First Name,last-name,tags 0\nAnn,Lee,1", MatchIgnoreSeparators, row{"Ann", "Lee", []int{1}},
+	}, {
+		"\uFEFFFirstName,last_name\nAnn,Lee", 0, row{"", "Lee", nil},
+	}, {
+		"\uFEFFFirstName,last_name\nAnn,Lee", MatchStripBOM, row{"Ann", "Lee", nil},
+	}, {
+		"\uFEFFFIRST NAME,LastName,Tags-0\nAnn,Lee,1", MatchLoose, row{"Ann", "Lee", []int{1}},
+	}} {
+		d := NewDecoder(strings.NewReader(c.s)).Opts(DecodeOpts{HeaderMatch: c.match, StrictHeader: c.want.FirstName != ""})
+		var r row
+		if err := d.DecodeNext(&r); err != nil {
+			t.Errorf("DecodeNext(%q): %v", c.s, err)
+		} else if !reflect.DeepEqual(r, c.want) {
+			t.Errorf("DecodeNext(%q): got %+v, want %+v", c.s, r, c.want)
+		}
+	}
+
+	// NormalizeHeader applies to field names and map keys too.
+	s := "x_firstname,x_last_name\nAnn,Lee"
+	opts := DecodeOpts{NormalizeHeader: func(h string) string { return strings.ToLower(strings.TrimPrefix(h, "x_")) }}
+	var r row
+	if err := NewDecoder(strings.NewReader(s)).Opts(opts).DecodeNext(&r); err != nil {
+		t.Fatalf("DecodeNext(%q): %v", s, err)
+	} else if want := (row{"Ann", "Lee", nil}); !reflect.DeepEqual(r, want) {
+		t.Errorf("DecodeNext(%q): got %+v, want %+v", s, r, want)
+	}
+	m := map[string]string{}
+	if err := NewDecoder(strings.NewReader(s)).Opts(opts).DecodeNext(&m); err != nil {
+		t.Fatalf("DecodeNext(%q): %v", s, err)
+	} else if want := map[string]string{"firstname": "Ann", "last_name": "Lee"}; !reflect.DeepEqual(m, want) {
+		t.Errorf("DecodeNext(%q): got %v, want %v", s, m, want)
+	}
+
+	// Distinct columns that match the same field are ambiguous.
+	s = "First Name,first_name,last_name\nAnn,Bo,Lee"
+	var herr *HeaderError
+	err := NewDecoder(strings.NewReader(s)).Opts(DecodeOpts{HeaderMatch: MatchLoose}).DecodeNext(&r)
+	if !errors.As(err, &herr) || !reflect.DeepEqual(herr.Ambiguous, []string{"First Name", "first_name"}) {
+		t.Errorf("DecodeNext(%q): got %v, want ambiguous columns", s, err)
+	}
+}
+
+func TestDecode_Aliases(t *testing.T) {
+	type row struct {
+		Zip  string `csv:"zip,alias=postal_code|postcode,required"`
+		Tags []int  `csv:"tags,expand,alias=labels"`
+	}
+	for _, c := range []struct {
+		s, want string
+		r       row
+	}{{
+		"zip,tags_0\n1,2", "", row{"1", []int{2}},
+	}, {
+		"postcode,labels_0,labels_1\n1,2,3", "", row{"1", []int{2, 3}},
+	}, {
+		"Postal_Code\n1", `invalid header row: missing required columns "zip"; unknown columns "Postal_Code"`, row{},
+	}, {
+		"postal_code,zip\n1,2", `invalid header row: ambiguous columns "zip", "postal_code"`, row{},
+	}, {
+		"zip,tags_0,labels_0\n1,2,3", `invalid header row: ambiguous columns "tags_0", "labels_0"`, row{},
+	}} {
+		var r row
+		err := NewDecoder(strings.NewReader(c.s)).Opts(DecodeOpts{StrictHeader: true}).DecodeNext(&r)
+		if c.want == "" {
+			if err != nil {
+				t.Errorf("DecodeNext(%q): %v", c.s, err)
+			} else if !reflect.DeepEqual(r, c.r) {
+				t.Errorf("DecodeNext(%q): got %+v, want %+v", c.s, r, c.r)
+			}
+		} else if err == nil || err.Error() != c.want {
+			t.Errorf("DecodeNext(%q): got %v, want %q", c.s, err, c.want)
+		}
+	}
+
+	// Errors name the column the field was decoded from.
+	s := "postcode,labels_0\n1,x"
+	var de *DecodeError
+	if err := NewDecoder(strings.NewReader(s)).DecodeNext(&row{}); !errors.As(err, &de) || de.Header != "labels_0" {
+		t.Errorf("DecodeNext(%q): got %v, want *DecodeError for labels_0", s, err)
+	}
+
+	// Aliases are matched like names.
+	s = "Post Code\n1"
+	var r row
+	if err := NewDecoder(strings.NewReader(s)).Opts(DecodeOpts{HeaderMatch: MatchLoose}).DecodeNext(&r); err != nil || r.Zip != "1" {
+		t.Errorf("DecodeNext(%q): got %+v, %v", s, r, err)
+	}
+
+	// A column matching both a name and an alias isn't ambiguous.
+	for _, c := range []struct {
+		s     string
+		match HeaderMatch
+		v     interface{}
+	}{
+		{"First Name\nAnn", MatchLoose, &struct {
+			FirstName string `csv:"first_name,alias=firstname"`
+		}{}},
+		{"ZIP\n1", MatchIgnoreCase, &struct {
+			Zip string `csv:"zip,alias=ZIP"`
+		}{}},
+	} {
+		opts := DecodeOpts{HeaderMatch: c.match, StrictHeader: true}
+		if err := NewDecoder(strings.NewReader(c.s)).Opts(opts).DecodeNext(c.v); err != nil {
+			t.Errorf("DecodeNext(%q): %v", c.s, err)
+		} else if got := reflect.ValueOf(c.v).Elem().Field(0).String(); got == "" {
+			t.Errorf("DecodeNext(%q): got %+v, want field set", c.s, c.v)
+		}
+	}
+}
+
+func TestDecode_Positions(t *testing.T) {
+	type row struct {
+		Date   string `csv:"#0"`
+		Amount int    `csv:"amount,index=2"`
+		Memo   string `csv:"memo"`
+	}
+	s := "2024-01-02,x,10\n2024-01-03,y,20"
+	rows, err := NewTypedDecoder[row](strings.NewReader(s)).Opts(DecodeOpts{NoHeader: true}).All()
+	if err != nil {
+		t.Fatalf("DecodeAll(%q): %v", s, err)
+	}
+	want := []row{{"2024-01-02", 10, ""}, {"2024-01-03", 20, ""}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("DecodeAll(%q): got %+v, want %+v", s, rows, want)
+	}
+
+	// Indexes take precedence over names in a header row.
+	s = "when,memo,amount\n2024-01-02,x,10"
+	var r row
+	if err := NewDecoder(strings.NewReader(s)).Opts(DecodeOpts{StrictHeader: true}).DecodeNext(&r); err != nil {
+		t.Fatalf("DecodeNext(%q): %v", s, err)
+	} else if want := (row{"2024-01-02", 10, "x"}); r != want {
+		t.Errorf("DecodeNext(%q): got %+v, want %+v", s, r, want)
+	}
+
+	// An explicit header row is used instead of the first row.
+	s = "2024-01-02,x,10"
+	d := NewDecoder(strings.NewReader(s)).Opts(DecodeOpts{Header: []string{"date", "memo", "amount"}})
+	if err := d.DecodeNext(&r); err != nil {
+		t.Fatalf("DecodeNext(%q): %v", s, err)
+	} else if want := (row{"2024-01-02", 10, "x"}); r != want {
+		t.Errorf("DecodeNext(%q): got %+v, want %+v", s, r, want)
+	}
+
+	// Rows shorter than an explicit header row are rejected.
+	row2 := "2024-01-02,x"
+	for _, v := range []interface{}{&r, &map[string]string{}} {
+		d = NewDecoder(strings.NewReader(row2)).Opts(DecodeOpts{Header: []string{"date", "memo", "amount"}})
+		if err := d.DecodeNext(v); !errors.Is(err, csv.ErrFieldCount) {
+			t.Errorf("DecodeNext(%q) into %T: got %v, want csv.ErrFieldCount", row2, v, err)
+		}
+	}
+
+	// Maps are keyed by column index without a header row.
+	m := map[string]string{}
+	if err := NewDecoder(strings.NewReader(s)).Opts(DecodeOpts{NoHeader: true}).DecodeNext(&m); err != nil {
+		t.Fatalf("DecodeNext(%q): %v", s, err)
+	} else if want := map[string]string{"#0": "2024-01-02", "#1": "x", "#2": "10"}; !reflect.DeepEqual(m, want) {
+		t.Errorf("DecodeNext(%q): got %v, want %v", s, m, want)
+	}
+
+	// Required columns may be missing by index.
+	type short struct {
+		A string `csv:",index=5,required"`
+	}
+	if err := NewDecoder(strings.NewReader(s)).Opts(DecodeOpts{NoHeader: true}).DecodeNext(&short{}); err == nil || err.Error() != `invalid header row: missing required columns "A"` {
+		t.Errorf("DecodeNext(%q): got %v, want missing required column", s, err)
+	}
+
+	for _, v := range []interface{}{
+		&struct {
+			A string `csv:"#0,index=x"`
+		}{},
+		&struct {
+			A string `csv:"#1,index=1"`
+		}{},
+		&struct {
+			A []string `csv:",expand,index=1"`
+		}{},
+	} {
+		if err := NewDecoder(strings.NewReader(s)).Opts(DecodeOpts{NoHeader: true}).DecodeNext(v); err == nil {
+			t.Errorf("DecodeNext(%T): got nil, want invalid tag error", v)
+		}
+	}
+}
+
+func TestDecode_Default(t *testing.T) {
+	type row struct {
+		Name    string        `csv:"name,default=anonymous"`
+		Retries int           `csv:"retries,default=3"`
+		Ratio   *float64      `csv:"ratio,default=2"`
+		Timeout time.Duration `csv:"timeout,default=30s"`
+		Amount  int           `csv:"amount,default=1.000"`
+	}
+	s := "name,retries,amount\nbob,5,2.000\n,,"
+	d := NewTypedDecoder[row](strings.NewReader(s)).Opts(DecodeOpts{Format: Format{ThousandsSep: '.', DecimalComma: true}})
+	rows, err := d.All()
+	if err != nil {
+		t.Fatalf("DecodeAll(%q): %v", s, err)
+	}
+	two := 2.0
+	want := []row{
+		{"bob", 5, &two, 30 * time.Second, 2000},
+		{"anonymous", 3, &two, 30 * time.Second, 1000},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("DecodeAll(%q): got %+v, want %+v", s, rows, want)
+	}
+
+	// Defaults that can't be decoded fail before any row is decoded.
+	for _, v := range []interface{}{
+		&struct {
+			A int `csv:"a,default=x"`
+		}{},
+		&struct {
+			A bool `csv:"a,default=maybe"`
+		}{},
+		&struct {
+			A []int `csv:"a,expand,default=1"`
+		}{},
+	} {
+		for _, s := range []string{"a_0,b\n1,1", "a_0,b"} {
+			err := NewDecoder(strings.NewReader(s)).DecodeNext(v)
+			var de *DecodeError
+			if err == nil || err == io.EOF || errors.As(err, &de) {
+				t.Errorf("DecodeNext(%q) into %T: got %v, want setup error", s, v, err)
+			}
+		}
+	}
+}
+
+func TestDecode_Embedded(t *testing.T) {
+	type Audit struct {
+		CreatedAt string
+		UpdatedBy string
+	}
+	type Address struct {
+		Street string
+		Zip    int `csv:"zip"`
+	}
+	type row struct {
+		Name string
+		*Audit
+		Addr Address  `csv:",inline,prefix=addr_"`
+		Ship *Address `csv:",inline,prefix=ship_"`
+	}
+	s := "Name,CreatedAt,UpdatedBy,addr_Street,addr_zip,ship_Street\na,today,me,Main St,12345,"
+	var r row
+	if err := NewDecoder(strings.NewReader(s)).DecodeNext(&r); err != nil {
+		t.Fatalf("DecodeNext(%q): %v", s, err)
+	}
+	want := row{"a", &Audit{"today", "me"}, Address{"Main St", 12345}, &Address{}}
+	if !reflect.DeepEqual(r, want) {
+		t.Errorf("DecodeNext(%q): got %+v, want %+v", s, r, want)
+	}
+
+	// Errors name the nested field.
+	s = "ship_zip\nx"
+	err := NewDecoder(strings.NewReader(s)).DecodeNext(&r)
+	var de *DecodeError
+	if !errors.As(err, &de) || de.Field != "Ship.Zip" {
+		t.Errorf("DecodeNext(%q): got %v, want error in field Ship.Zip", s, err)
+	}
+}
+
 func TestDecode_CompatibleTypes(t *testing.T) {
 	// Attempting to parse an int as a string will succeed
 	s := "String\n123"
@@ -246,6 +660,67 @@ func TestDecode_Map(t *testing.T) {
 	}
 }
 
+func TestDecode_MapTyped(t *testing.T) {
+	s := "foo,bar\n1,2"
+	want := map[string]int{
+		"foo": 1,
+		"bar": 2,
+	}
+	var got map[string]int
+	if err := NewDecoder(strings.NewReader(s)).DecodeNext(&got); err != nil {
+		t.Errorf("%v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DecodeNext(%q): got %v, want %v", s, got, want)
+	}
+}
+
+func TestDecode_MapInterface(t *testing.T) {
+	s := "int,float,bool,time,string,empty\n-12,1.5,true,2014-06-01T12:00:00Z,hello,"
+	ts := time.Date(2014, 6, 1, 12, 0, 0, 0, time.UTC)
+	for _, c := range []struct {
+		infer Inference
+		want  map[string]interface{}
+	}{{
+		0,
+		map[string]interface{}{"int": int64(-12), "float": 1.5, "bool": true, "time": ts, "string": "hello", "empty": ""},
+	}, {
+		InferAll,
+		map[string]interface{}{"int": int64(-12), "float": 1.5, "bool": true, "time": ts, "string": "hello", "empty": ""},
+	}, {
+		InferFloat | InferBool,
+		map[string]interface{}{"int": -12.0, "float": 1.5, "bool": true, "time": "2014-06-01T12:00:00Z", "string": "hello", "empty": ""},
+	}, {
+		InferNone,
+		map[string]interface{}{"int": "-12", "float": "1.5", "bool": "true", "time": "2014-06-01T12:00:00Z", "string": "hello", "empty": ""},
+	}} {
+		got := map[string]interface{}{}
+		d := NewDecoder(strings.NewReader(s)).Opts(DecodeOpts{Infer: c.infer})
+		if err := d.DecodeNext(&got); err != nil {
+			t.Errorf("%v", err)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("DecodeNext(%q) with Infer %v: got %v, want %v", s, c.infer, got, c.want)
+		}
+		if !isDone(d) {
+			t.Errorf("decoder unexpectedly not done")
+		}
+	}
+
+	// Values that would lose data aren't inferred.
+	s = "zip,neg,hex,zero,frac,t,f,True,nan,inf,big\n02134,-007,0x1F,0,0.5,T,F,True,NaN,-Inf,1e400"
+	want := map[string]interface{}{
+		"zip": "02134", "neg": "-007", "hex": "0x1F", "zero": int64(0), "frac": 0.5,
+		"t": "T", "f": "F", "True": "True", "nan": "NaN", "inf": "-Inf", "big": "1e400",
+	}
+	got := map[string]interface{}{}
+	if err := NewDecoder(strings.NewReader(s)).DecodeNext(&got); err != nil {
+		t.Fatalf("DecodeNext(%q): %v", s, err)
+	} else if !reflect.DeepEqual(got, want) {
+		t.Errorf("DecodeNext(%q): got %v, want %v", s, got, want)
+	}
+}
+
 func TestDecode_MapErrors(t *testing.T) {
 	d := NewDecoder(strings.NewReader("foo,bar\na,b"))
 
@@ -263,6 +738,16 @@ func TestDecode_MapErrors(t *testing.T) {
 	if err := d.DecodeNext(m2); err == nil {
 		t.Errorf("expected error")
 	}
+
+	m3 := map[string]int{}
+	if err := NewDecoder(strings.NewReader("foo\nbar")).DecodeNext(&m3); err == nil {
+		t.Errorf("expected error")
+	}
+
+	m4 := map[string]fmt.Stringer{}
+	if err := NewDecoder(strings.NewReader("foo\nbar")).DecodeNext(&m4); err == nil {
+		t.Errorf("expected error")
+	}
 }
 
 // Tests that values that implement encoding.TextUnarshaler are correctly unmarshaled.
@@ -278,6 +763,66 @@ func TestDecode_TextUnmarshaler(t *testing.T) {
 	}
 }
 
+func TestDecodeAll(t *testing.T) {
+	s := "Foo,Bar\na,b\nc,d"
+	type row struct{ Foo, Bar string }
+
+	var rows []row
+	if err := DecodeAll(strings.NewReader(s), &rows); err != nil {
+		t.Errorf("DecodeAll(%q): %v", s, err)
+	}
+	want := []row{{"a", "b"}, {"c", "d"}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("DecodeAll(%q): got %v, want %v", s, rows, want)
+	}
+
+	var ptrs []*row
+	if err := DecodeAll(strings.NewReader(s), &ptrs); err != nil {
+		t.Errorf("DecodeAll(%q): %v", s, err)
+	}
+	wantPtrs := []*row{{"a", "b"}, {"c", "d"}}
+	if !reflect.DeepEqual(ptrs, wantPtrs) {
+		t.Errorf("DecodeAll(%q): got %v, want %v", s, ptrs, wantPtrs)
+	}
+
+	var maps []map[string]string
+	if err := DecodeAll(strings.NewReader(s), &maps); err != nil {
+		t.Errorf("DecodeAll(%q): %v", s, err)
+	}
+	wantMaps := []map[string]string{{"Foo": "a", "Bar": "b"}, {"Foo": "c", "Bar": "d"}}
+	if !reflect.DeepEqual(maps, wantMaps) {
+		t.Errorf("DecodeAll(%q): got %v, want %v", s, maps, wantMaps)
+	}
+
+	// Rows already in the slice are replaced, and a header with no
+	// rows decodes to an empty slice.
+	if err := DecodeAll(strings.NewReader("Foo,Bar"), &rows); err != nil {
+		t.Errorf("DecodeAll: %v", err)
+	}
+	if len(rows) != 0 {
+		t.Errorf("DecodeAll: got %v, want empty", rows)
+	}
+}
+
+func TestDecodeAll_Errors(t *testing.T) {
+	s := "Int\n1\nfoo"
+	var rows []struct{ Int int }
+	if err := DecodeAll(strings.NewReader(s), &rows); err == nil {
+		t.Errorf("DecodeAll(%q): expected error", s)
+	}
+	if len(rows) != 1 {
+		t.Errorf("DecodeAll(%q): got %d rows before error, want 1", s, len(rows))
+	}
+
+	if err := DecodeAll(strings.NewReader(s), rows); err == nil {
+		t.Errorf("expected error decoding into non-pointer")
+	}
+	var strs []string
+	if err := DecodeAll(strings.NewReader(s), &strs); err == nil {
+		t.Errorf("expected error decoding into slice of strings")
+	}
+}
+
 func isDone(d Decoder) bool {
 	return d.DecodeNext(nil) == io.EOF
 }
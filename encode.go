@@ -12,15 +12,35 @@ import (
 
 var textMarshalerType = reflect.TypeOf(new(encoding.TextMarshaler)).Elem()
 
+var errClosed = errors.New("encoder is closed")
+
 // Encoder encodes and writes CSV rows to an output stream.
 type Encoder interface {
 	// EncodeNext encodes v into a CSV row and writes it to the Encoder's
 	// Writer.
 	//
+	// v must be a struct, or a map with string keys, or a pointer to one;
+	// nil pointers are skipped. Map values are formatted like struct fields
+	// of the same type, and values of interface type by their dynamic
+	// types.
+	//
 	// On the first call to EncodeNext, v's fields will be used to write the
 	// header row, then v's values will be written as the second row.
+	//
+	// Rows are buffered; call Flush or Close to write them.
 	EncodeNext(v interface{}) error
 
+	// Flush writes any buffered rows to the Encoder's Writer.
+	//
+	// Rows are buffered until the buffer fills, so Flush must be called
+	// once encoding is done, and may be called earlier, such as to make
+	// rows visible to readers sooner.
+	Flush() error
+
+	// Close flushes any buffered rows, after which encoding fails. It
+	// doesn't close the Encoder's Writer.
+	Close() error
+
 	// Opts specifies options to modify encoding behavior.
 	//
 	// It returns the Encoder, to support chaining.
@@ -32,12 +52,47 @@ type EncodeOpts struct {
 	SkipHeader bool // True to skip writing the header row
 	Comma      rune // Field delimiter (set to ',' by default)
 	UseCRLF    bool // True to use \r\n as the line terminator
+
+	// Converters holds custom conversions to cell values, which take
+	// precedence over built-in conversions.
+	Converters *Converters
+
+	// Format specifies how booleans, nulls and numbers are represented in
+	// cells.
+	Format Format
+
+	// Columns, if non-nil, lists the columns of the header row in the
+	// order they're written. Struct fields and map keys that aren't listed
+	// are left out, and encoding a struct fails if a listed column doesn't
+	// map to any of its fields.
+	//
+	// Without Columns, struct fields are written in the order given by
+	// their "order" options, then in declaration order, and map keys are
+	// sorted.
+	Columns []string
+
+	// UnionKeys causes maps to be buffered until the first Flush or Close,
+	// or the end of TypedEncoder.EncodeAll, and a header row written with
+	// the sorted union of their keys, rather than only those of the first
+	// map. Keys first seen after that are left out, as without UnionKeys. It
+	// has no effect if Columns is set.
+	UnionKeys bool
+
+	// StrictKeys causes encoding a map to fail if it has keys that aren't
+	// in the header row, rather than leaving them out.
+	StrictKeys bool
 }
 
 type encoder struct {
-	w    csv.Writer
-	hm   map[string]int
-	opts EncodeOpts
+	w       csv.Writer
+	hm      map[string]int
+	omitted map[string]bool // columns left out by EncodeOpts.Columns
+	opts    EncodeOpts
+	format  *Format // nil if the zero Format
+	plans   map[reflect.Type]structPlan
+	values  map[reflect.Type]encodeFunc // encodeFuncs of map values
+	pending []map[string]string         // cells of maps buffered by UnionKeys
+	closed  bool
 }
 
 // NewEncoder returns an encoder that writes to w.
@@ -52,165 +107,409 @@ func (e *encoder) Opts(opts EncodeOpts) Encoder {
 	}
 	e.w.UseCRLF = opts.UseCRLF
 	e.opts = opts
+	e.format = nil
+	if !opts.Format.isZero() {
+		e.format = &opts.Format
+	}
 	return e
 }
 
 func (e *encoder) EncodeNext(v interface{}) error {
+	if e.closed {
+		return errClosed
+	}
 	if v == nil {
 		return nil
 	}
-	switch reflect.ValueOf(v).Type().Kind() {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
 	case reflect.Map:
-		return e.encodeMap(v)
+		return e.encodeMap(rv)
 	case reflect.Struct:
-		return e.encodeStruct(v)
+		return e.encodeStruct(rv)
 	default:
 		return errors.New("must encode map or struct")
 	}
 }
 
-func (e *encoder) encodeMap(v interface{}) error {
-	if reflect.ValueOf(v).Type().Key().Kind() != reflect.String {
+// EncodeAll encodes each element of v, which must be a slice or array of
+// structs or maps, or of pointers to them, and writes the result to w.
+//
+// Nil pointer elements are skipped. To encode with EncodeOpts, use
+// TypedEncoder.EncodeAll.
+func EncodeAll(w io.Writer, v interface{}) error {
+	return NewEncoder(w).(*encoder).encodeAll(v)
+}
+
+// encodeAll encodes each element of v as if by EncodeNext, and flushes the
+// Writer before returning.
+func (e *encoder) encodeAll(v interface{}) error {
+	if e.closed {
+		return errClosed
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return errors.New("must encode slice or array")
+	}
+	et := rv.Type().Elem()
+	isPtr := et.Kind() == reflect.Ptr
+	if isPtr {
+		et = et.Elem()
+	}
+	var encode func(reflect.Value) error
+	switch et.Kind() {
+	case reflect.Map:
+		encode = e.encodeMap
+	case reflect.Struct:
+		encode = e.encodeStruct
+	default:
+		return errors.New("must encode slice of maps or structs")
+	}
+
+	for i := 0; i < rv.Len(); i++ {
+		ev := rv.Index(i)
+		if isPtr {
+			if ev.IsNil() {
+				continue
+			}
+			ev = ev.Elem()
+		}
+		if err := encode(ev); err != nil {
+			e.Flush()
+			return err
+		}
+	}
+	return e.Flush()
+}
+
+func (e *encoder) Flush() error {
+	if err := e.writePending(); err != nil {
+		return err
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func (e *encoder) Close() error {
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	return e.Flush()
+}
+
+func (e *encoder) encodeMap(rv reflect.Value) error {
+	t := rv.Type()
+	if t.Key().Kind() != reflect.String {
 		return errors.New("map key must be string")
 	}
-	m := v.(map[string]interface{})
+	encode, err := e.valueEncodeFunc(t.Elem())
+	if err != nil {
+		return err
+	}
 
+	if e.hm == nil && e.opts.UnionKeys && e.opts.Columns == nil {
+		// Buffer the map until the union of keys is known.
+		cells := make(map[string]string, rv.Len())
+		for it := rv.MapRange(); it.Next(); {
+			k := it.Key().String()
+			s, err := encode(it.Value())
+			if err != nil {
+				return fmt.Errorf("key %q: %w", k, err)
+			}
+			cells[k] = s
+		}
+		if len(cells) != 0 {
+			e.pending = append(e.pending, cells)
+		}
+		return nil
+	}
 	if e.hm == nil {
-		e.hm = make(map[string]int)
-		headers := []string{}
-		for k := range m {
-			headers = append(headers, k)
-		}
-		sort.Strings(headers)
-		for i, h := range headers {
-			e.hm[h] = i
-		}
-		if len(e.hm) == 0 {
-			// First row was an empty map, so write nothing.
-			// This will result in an empty output no matter what is Encoded.
-			return nil
+		headers := e.opts.Columns
+		if headers == nil {
+			for _, k := range rv.MapKeys() {
+				headers = append(headers, k.String())
+			}
+			sort.Strings(headers)
 		}
-		if !e.opts.SkipHeader {
-			if err := e.w.Write(headers); err != nil {
-				return err
+		if err := e.writeHeader(headers); err != nil {
+			return err
+		}
+	}
+	if len(e.hm) == 0 {
+		// First row was an empty map, so write nothing.
+		// This will result in an empty output no matter what is Encoded.
+		return nil
+	}
+	if e.opts.StrictKeys {
+		var unknown []string
+		for _, k := range rv.MapKeys() {
+			if _, ok := e.hm[k.String()]; !ok {
+				unknown = append(unknown, k.String())
 			}
 		}
+		if len(unknown) != 0 {
+			sort.Strings(unknown)
+			return fmt.Errorf("keys not in header row: %s", quoteAll(unknown))
+		}
 	}
-	row := make([]string, len(m))
+	row := make([]string, len(e.hm))
 	add := false // Whether there has been a row to write in this call.
 	for h, i := range e.hm {
-		val, ok := m[h]
-		if !ok {
+		val := rv.MapIndex(reflect.ValueOf(h).Convert(t.Key()))
+		if !val.IsValid() {
 			continue
 		}
 		add = true
-		row[i] = fmt.Sprint(val)
+		s, err := encode(val)
+		if err != nil {
+			return fmt.Errorf("key %q: %w", h, err)
+		}
+		row[i] = s
 	}
 	if !add {
 		return nil
 	}
-	if err := e.w.Write(row); err != nil {
-		return err
-	}
-	e.w.Flush()
-	return e.w.Error()
+	return e.w.Write(row)
 }
 
-func (e *encoder) encodeStruct(v interface{}) error {
-	t := reflect.ValueOf(v).Type()
+func (e *encoder) encodeStruct(rv reflect.Value) error {
+	if err := e.writePending(); err != nil {
+		return err
+	}
 	if e.hm == nil {
-		e.hm = make(map[string]int)
-		headers := []string{}
-		i := 0
-		for j := 0; j < t.NumField(); j++ {
-			f := t.Field(j)
-			if f.Anonymous {
-				continue
+		fields := cachedFields(rv.Type())
+		groups := make([][]string, len(fields)) // columns of each field
+		for i, f := range fields {
+			cols := []string{f.name}
+			if f.err != nil {
+				return fmt.Errorf("field %s: %w", f.fieldName, f.err)
 			}
-			if f.PkgPath != "" { // Filter unexported fields
-				continue
-			}
-			n := f.Name
-			if f.Tag.Get("csv") != "" {
-				n = f.Tag.Get("csv")
-				if n == "-" {
-					continue
+			if f.marshal {
+				var err error
+				if cols, err = marshalColumns(rv, &fields[i]); err != nil {
+					return err
+				}
+			} else if f.expand {
+				n := f.expandN
+				if fv := fieldByIndex(rv, f.index, false); n == 0 && fv.IsValid() {
+					n = fv.Len()
+				}
+				cols = make([]string, n)
+				for j := range cols {
+					cols[j] = expandColumn(f.name, j)
 				}
 			}
-			headers = append(headers, n)
-			e.hm[n] = i
-			i++
+			groups[i] = cols
 		}
-		if len(e.hm) == 0 {
-			// Header row has no exported, unignored fields, so write nothing.
-			// This will result in an empty output no matter what is Encoded.
-			return nil
+		order := make([]int, len(fields))
+		for i := range order {
+			order[i] = i
 		}
-		if !e.opts.SkipHeader {
-			if err := e.w.Write(headers); err != nil {
-				return err
+		sort.SliceStable(order, func(i, j int) bool {
+			a, b := &fields[order[i]], &fields[order[j]]
+			return a.hasOrder && (!b.hasOrder || a.order < b.order)
+		})
+		headers := make([]string, 0, len(fields))
+		for _, i := range order {
+			headers = append(headers, groups[i]...)
+		}
+		if e.opts.Columns != nil {
+			known := make(map[string]bool, len(headers))
+			for _, h := range headers {
+				known[h] = true
+			}
+			for _, c := range e.opts.Columns {
+				if !known[c] {
+					return fmt.Errorf("column %q doesn't map to any field", c)
+				}
+				delete(known, c)
 			}
+			headers, e.omitted = e.opts.Columns, known
+		}
+		if err := e.writeHeader(headers); err != nil {
+			return err
 		}
 	}
+	if len(e.hm) == 0 {
+		// Header row has no exported, unignored fields, so write nothing.
+		// This will result in an empty output no matter what is Encoded.
+		return nil
+	}
 
-	rv := reflect.ValueOf(v)
+	p := e.plan(rv.Type())
+	if p.err != nil {
+		return p.err
+	}
+	if len(p.fields) == 0 {
+		// No fields are mapped to the header row.
+		return nil
+	}
 	row := make([]string, len(e.hm))
-	add := false // Whether there has been a row to write in this call.
-	for i := 0; i < t.NumField(); i++ {
-		f := t.Field(i)
-		if f.PkgPath != "" { // Filter unexported fields
+	for _, f := range p.fields {
+		fv := fieldByIndex(rv, f.index, false)
+		if !fv.IsValid() {
+			// Field is in a nil embedded or inline struct.
 			continue
 		}
-		n := f.Name
-		if f.Tag.Get("csv") != "" {
-			n = f.Tag.Get("csv")
+		if f.omitempty && fv.IsZero() {
+			continue
 		}
-
-		fi, ok := e.hm[n]
-		if !ok {
-			// Unmapped header value
+		if f.marshal {
+			r, err := marshalCSV(fv, f.name)
+			if err != nil {
+				return err
+			}
+			for i, c := range r.columns {
+				if col, ok := e.hm[c]; ok {
+					row[col] = r.values[i]
+				}
+			}
 			continue
+		} else if f.expand {
+			if err := encodeExpanded(fv, row, f.cols, f.encode); err != nil {
+				return fmt.Errorf("field %s: %w", f.fieldName, err)
+			}
+			continue
+		} else if f.col < 0 {
+			continue
+		}
+		s, err := f.encode(fv)
+		if err != nil {
+			return err
 		}
+		row[f.col] = s
+	}
+	return e.w.Write(row)
+}
 
-		add = true
-		vf := rv.Field(i)
+// writeHeader sets the columns of the header row to headers, and writes it
+// unless SkipHeader is set or it's empty.
+func (e *encoder) writeHeader(headers []string) error {
+	e.hm = make(map[string]int, len(headers))
+	for i, h := range headers {
+		e.hm[h] = i
+	}
+	if len(headers) == 0 || e.opts.SkipHeader {
+		return nil
+	}
+	return e.w.Write(headers)
+}
 
-		if vf.Type().Implements(textMarshalerType) {
-			if tm, ok := vf.Interface().(encoding.TextMarshaler); ok {
-				b, err := tm.MarshalText()
-				if err != nil {
-					return err
-				}
-				row[fi] = string(b)
-				continue
-			} else {
-				panic("unreachable")
+// writePending writes the header row with the union of the keys of the maps
+// buffered by UnionKeys, followed by their rows.
+func (e *encoder) writePending() error {
+	if len(e.pending) == 0 {
+		return nil
+	}
+	seen := map[string]bool{}
+	var keys []string
+	for _, cells := range e.pending {
+		for k := range cells {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
 			}
 		}
-		if vf.Kind() == reflect.Ptr {
-			vf = vf.Elem()
+	}
+	sort.Strings(keys)
+	if err := e.writeHeader(keys); err != nil {
+		return err
+	}
+	for _, cells := range e.pending {
+		row := make([]string, len(keys))
+		for k, s := range cells {
+			row[e.hm[k]] = s
 		}
-		switch vf.Kind() {
-		case reflect.String:
-			row[fi] = vf.String()
-		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-			row[fi] = fmt.Sprintf("%d", vf.Int())
-		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-			row[fi] = fmt.Sprintf("%d", vf.Uint())
-		case reflect.Float64:
-			row[fi] = fmt.Sprintf("%f", vf.Float())
-		case reflect.Bool:
-			row[fi] = fmt.Sprintf("%t", vf.Bool())
-		default:
-			return fmt.Errorf("can't encode type %v", f.Type)
+		if err := e.w.Write(row); err != nil {
+			return err
 		}
 	}
-	if !add {
-		return nil
+	e.pending = nil
+	return nil
+}
+
+// valueEncodeFunc returns an encodeFunc for map values of type t, using the
+// Encoder's Converters and Format.
+//
+// Values of interface type are encoded by their dynamic types, as with
+// fmt.Sprint if there's no built-in or registered conversion for them, and nil
+// interfaces like nil pointers.
+func (e *encoder) valueEncodeFunc(t reflect.Type) (encodeFunc, error) {
+	if enc, ok := e.values[t]; ok {
+		return enc, nil
 	}
-	if err := e.w.Write(row); err != nil {
-		return err
+	var enc encodeFunc
+	if t.Kind() == reflect.Interface {
+		nilEnc := e.format.encodeNull(func(reflect.Value) (string, error) { return "", nil })
+		nilPtr := reflect.Zero(reflect.PointerTo(t))
+		enc = func(v reflect.Value) (string, error) {
+			if v.IsNil() {
+				return nilEnc(nilPtr)
+			}
+			dt := v.Elem().Type()
+			if !canEncode(dt) {
+				if cv, _, _ := e.opts.Converters.lookup(dt, ""); cv.format == nil {
+					return fmt.Sprint(v.Elem().Interface()), nil
+				}
+			}
+			dyn, err := e.valueEncodeFunc(dt)
+			if err != nil {
+				return "", err
+			}
+			return dyn(v.Elem())
+		}
+	} else {
+		var err error
+		if enc, err = e.opts.Converters.encodeFunc(t, ""); err != nil {
+			return nil, err
+		} else if enc == nil {
+			if enc, err = newEncodeFunc(t, nil, e.format); err != nil {
+				return nil, err
+			}
+		}
+		enc = e.format.encodeNull(enc)
 	}
-	e.w.Flush()
-	return e.w.Error()
+	if e.values == nil {
+		e.values = make(map[reflect.Type]encodeFunc)
+	}
+	e.values[t] = enc
+	return enc, nil
+}
+
+// column returns the index of the named column in the header row, or -1 if
+// the column was left out by EncodeOpts.Columns, and whether the struct
+// being encoded has such a column.
+func (e *encoder) column(name string) (int, bool) {
+	if col, ok := e.hm[name]; ok {
+		return col, true
+	}
+	return -1, e.omitted[name]
+}
+
+// position always reports false, since an Encoder ignores "index" options.
+func (e *encoder) position(int) (int, bool) { return 0, false }
+
+// plan returns the fields of struct type t that are mapped to a column in the
+// header row.
+func (e *encoder) plan(t reflect.Type) structPlan {
+	if p, ok := e.plans[t]; ok {
+		return p
+	}
+	var p structPlan
+	p.fields, p.err = bindFields(t, e, e.opts.Converters, e.format)
+	if e.plans == nil {
+		e.plans = make(map[reflect.Type]structPlan)
+	}
+	e.plans[t] = p
+	return p
 }
@@ -5,6 +5,7 @@ import (
 	"net"
 	"strings"
 	"testing"
+	"time"
 )
 
 // Accounts for changes between Go 1.3 and 1.4 that changed how encoding/csv encodes empty strings
@@ -76,7 +77,7 @@ a,b,d
 			Bool    bool
 		}{123, -123456789, 123456789, 123.456, true}},
 		`Int,Int64,Uint64,Float64,Bool
-123,-123456789,123456789,123.456000,true
+123,-123456789,123456789,123.456,true
 `,
 	}, {
 		// Encoding rows with different fields.
@@ -110,6 +111,9 @@ true
 				t.Errorf("EncodeNext(%v): %v", r, err)
 			}
 		}
+		if err := e.Flush(); err != nil {
+			t.Errorf("Flush(): %v", err)
+		}
 		got := buf.String()
 		if backcompat {
 			got = strings.Replace(got, `""`, "", -1)
@@ -150,6 +154,9 @@ d,e,f
 				t.Errorf("EncodeNext(%v): %v", r, err)
 			}
 		}
+		if err := e.Flush(); err != nil {
+			t.Errorf("Flush(): %v", err)
+		}
 		if got := buf.String(); got != c.want {
 			t.Errorf("EncodeNext(%v): got %s, want %s", rows, got, c.want)
 		}
@@ -204,6 +211,9 @@ true
 				t.Errorf("EncodeNext(%v): %v", r, err)
 			}
 		}
+		if err := e.Flush(); err != nil {
+			t.Errorf("Flush(): %v", err)
+		}
 		got := buf.String()
 		if backcompat {
 			got = strings.Replace(got, `""`, "", -1)
@@ -214,6 +224,65 @@ true
 	}
 }
 
+func TestEncode_MapTyped(t *testing.T) {
+	when := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	n := 5
+	for _, c := range []struct {
+		m    interface{}
+		want string
+	}{
+		{map[string]string{"b": "x", "a": "y"}, "a,b\ny,x\n"},
+		{map[string]int{"n": 1}, "n\n1\n"},
+		{map[string]*int{"a": &n, "b": nil}, "a,b\n5,\n"},
+		{map[string]time.Time{"t": when}, "t\n2024-01-02T03:04:05Z\n"},
+		{map[string]net.IP{"ip": ip}, "ip\n128.0.0.1\n"},
+		{map[string]interface{}{"t": when, "f": 0.1, "nil": nil}, "f,nil,t\n0.1,,2024-01-02T03:04:05Z\n"},
+		{&map[string]int{"n": 1}, "n\n1\n"},
+		{&struct{ N int }{1}, "N\n1\n"},
+		{(*struct{ N int })(nil), ""},
+	} {
+		var buf bytes.Buffer
+		e := NewEncoder(&buf)
+		if err := e.EncodeNext(c.m); err != nil {
+			t.Errorf("EncodeNext(%v): %v", c.m, err)
+		} else if err := e.Flush(); err != nil {
+			t.Errorf("Flush(): %v", err)
+		} else if got := buf.String(); got != c.want {
+			t.Errorf("EncodeNext(%v): got %q, want %q", c.m, got, c.want)
+		}
+	}
+
+	// Map values go through the Encoder's Converters and Format.
+	var buf bytes.Buffer
+	e := NewEncoder(&buf).Opts(EncodeOpts{Converters: testConverters(), Format: Format{Null: []string{"NULL"}}})
+	m := map[string]interface{}{"price": money{100, "USD"}, "none": nil}
+	if err := e.EncodeNext(m); err != nil {
+		t.Errorf("EncodeNext(%v): %v", m, err)
+	} else if err := e.Flush(); err != nil {
+		t.Errorf("Flush(): %v", err)
+	} else if got, want := buf.String(), "none,price\nNULL,100 USD\n"; got != want {
+		t.Errorf("EncodeNext(%v): got %q, want %q", m, got, want)
+	}
+
+	// Dynamic values without a conversion are formatted by fmt.Sprint.
+	buf.Reset()
+	e = NewEncoder(&buf)
+	m = map[string]interface{}{"m": map[string]int{"a": 1}, "s": []interface{}{1, "x"}, "v": struct{ A int }{2}}
+	if err := e.EncodeNext(m); err != nil {
+		t.Errorf("EncodeNext(%v): %v", m, err)
+	} else if err := e.Flush(); err != nil {
+		t.Errorf("Flush(): %v", err)
+	} else if got, want := buf.String(), "m,s,v\nmap[a:1],[1 x],{2}\n"; got != want {
+		t.Errorf("EncodeNext(%v): got %q, want %q", m, got, want)
+	}
+
+	// Values that can't be encoded are reported as errors.
+	bad := map[string]chan int{"c": nil}
+	if err := NewEncoder(&bytes.Buffer{}).EncodeNext(bad); err == nil {
+		t.Errorf("EncodeNext(%v): got nil, want error", bad)
+	}
+}
+
 // Tests that encoding a struct then encoding a compatible map works as expected.
 func TestEncode_Hybrid(t *testing.T) {
 	var buf bytes.Buffer
@@ -236,6 +305,9 @@ func TestEncode_Hybrid(t *testing.T) {
 a,b
 c,d
 `
+	if err := e.Flush(); err != nil {
+		t.Errorf("Flush(): %v", err)
+	}
 	if got := buf.String(); got != want {
 		t.Errorf("EncodeNext(%v): got %s, want %s", m, got, want)
 	}
@@ -252,6 +324,9 @@ func TestEncode_TextMarshaler(t *testing.T) {
 	want := `N
 128.0.0.1
 `
+	if err := e.Flush(); err != nil {
+		t.Errorf("Flush(): %v", err)
+	}
 	if got := buf.String(); got != want {
 		t.Errorf("EncodeNext(%v): got %s, want %s", r, got, want)
 	}
@@ -272,7 +347,299 @@ func TestEncode_Ptrs(t *testing.T) {
 	want := `S,SP
 bar,bar
 `
+	if err := e.Flush(); err != nil {
+		t.Errorf("Flush(): %v", err)
+	}
 	if got := buf.String(); got != want {
 		t.Errorf("EncodeNext(%v): got %s, want %s", s, got, want)
 	}
 }
+
+func TestEncodeAll(t *testing.T) {
+	type row struct{ Foo, Bar string }
+	want := `Foo,Bar
+a,b
+c,d
+`
+	for _, c := range []struct {
+		v    interface{}
+		want string
+	}{
+		{[]row{{"a", "b"}, {"c", "d"}}, want},
+		{[2]row{{"a", "b"}, {"c", "d"}}, want},
+		{&[]row{{"a", "b"}, {"c", "d"}}, want},
+		{[]*row{{"a", "b"}, nil, {"c", "d"}}, want},
+		{[]map[string]interface{}{{"Foo": "a", "Bar": "b"}, {"Foo": "c", "Bar": "d"}}, "Bar,Foo\nb,a\nd,c\n"},
+	} {
+		var buf bytes.Buffer
+		if err := EncodeAll(&buf, c.v); err != nil {
+			t.Errorf("EncodeAll(%v): %v", c.v, err)
+		}
+		if got := buf.String(); got != c.want {
+			t.Errorf("EncodeAll(%v): got %s, want %s", c.v, got, c.want)
+		}
+	}
+
+	for _, v := range []interface{}{
+		row{"a", "b"},
+		[]string{"a", "b"},
+	} {
+		if err := EncodeAll(&bytes.Buffer{}, v); err == nil {
+			t.Errorf("EncodeAll(%v): expected error", v)
+		}
+	}
+}
+
+func TestEncode_Embedded(t *testing.T) {
+	type Audit struct {
+		CreatedAt string
+		UpdatedBy string
+	}
+	type Address struct {
+		Street string
+		Zip    int `csv:"zip"`
+	}
+	type row struct {
+		Name string
+		*Audit
+		Addr Address  `csv:",inline,prefix=addr_"`
+		Ship *Address `csv:",inline,prefix=ship_"`
+	}
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	for _, r := range []row{
+		{"a", &Audit{"today", "me"}, Address{"Main St", 12345}, &Address{"Elm St", 54321}},
+		{"b", nil, Address{}, nil},
+	} {
+		if err := e.EncodeNext(r); err != nil {
+			t.Errorf("EncodeNext(%v): %v", r, err)
+		}
+	}
+	want := `Name,CreatedAt,UpdatedBy,addr_Street,addr_zip,ship_Street,ship_zip
+a,today,me,Main St,12345,Elm St,54321
+b,,,,0,,
+`
+	if err := e.Flush(); err != nil {
+		t.Errorf("Flush(): %v", err)
+	}
+	if got := buf.String(); got != want {
+		t.Errorf("EncodeNext(): got %s, want %s", got, want)
+	}
+}
+
+func TestEncode_Numeric(t *testing.T) {
+	type row struct {
+		Int8       int8
+		Uint8      uint8
+		Uintptr    uintptr
+		Float32    float32
+		Float64    float64
+		Big        float64
+		Small      float64
+		Complex64  complex64
+		Complex128 complex128
+	}
+	var buf bytes.Buffer
+	r := row{-128, 255, 42, 0.1, 1.0 / 3, 1e21, 1e-7, complex(1, -2), complex(0.5, 1.5)}
+	e := NewEncoder(&buf)
+	if err := e.EncodeNext(r); err != nil {
+		t.Errorf("EncodeNext(%v): %v", r, err)
+	}
+	want := `Int8,Uint8,Uintptr,Float32,Float64,Big,Small,Complex64,Complex128
+-128,255,42,0.1,0.3333333333333333,1e+21,1e-07,(1-2i),(0.5+1.5i)
+`
+	if err := e.Flush(); err != nil {
+		t.Errorf("Flush(): %v", err)
+	}
+	if got := buf.String(); got != want {
+		t.Errorf("EncodeNext(%v): got %s, want %s", r, got, want)
+	}
+}
+
+// Tests that tag options, ignored fields and nil pointers are encoded
+// correctly.
+func TestEncode_TagOptions(t *testing.T) {
+	type row struct {
+		Name    string  `csv:"name,omitempty"`
+		Count   int     `csv:"count,omitempty"`
+		Ptr     *string `csv:"ptr"`
+		IP      *net.IP `csv:"ip"`
+		Ignored string  `csv:"-"`
+	}
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	s := "s"
+	for _, r := range []row{
+		{"a", 1, &s, &ip, "x"},
+		{"", 0, nil, nil, "y"},
+	} {
+		if err := e.EncodeNext(r); err != nil {
+			t.Errorf("EncodeNext(%v): %v", r, err)
+		}
+	}
+	want := `name,count,ptr,ip
+a,1,s,128.0.0.1
+,,,
+`
+	if err := e.Flush(); err != nil {
+		t.Errorf("Flush(): %v", err)
+	}
+	if got := buf.String(); got != want {
+		t.Errorf("EncodeNext(): got %s, want %s", got, want)
+	}
+}
+
+func TestEncode_Aliases(t *testing.T) {
+	type row struct {
+		Zip  string `csv:"zip,alias=postal_code|postcode"`
+		Tags []int  `csv:"tags,expand,alias=labels"`
+	}
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	r := row{"1", []int{2}}
+	if err := e.EncodeNext(r); err != nil {
+		t.Errorf("EncodeNext(%v): %v", r, err)
+	}
+	// Only the primary names are written.
+	want := "zip,tags_0\n1,2\n"
+	if err := e.Flush(); err != nil {
+		t.Errorf("Flush(): %v", err)
+	}
+	if got := buf.String(); got != want {
+		t.Errorf("EncodeNext(): got %q, want %q", got, want)
+	}
+}
+
+func TestEncode_Columns(t *testing.T) {
+	type row struct {
+		Name  string
+		ID    int   `csv:"id,order=1"`
+		Tags  []int `csv:"tags,expand=2"`
+		Price price `csv:"price,order=2"`
+	}
+	r := row{"a", 1, []int{2, 3}, price{1.5, "USD"}}
+	for _, c := range []struct {
+		cols []string
+		want string
+	}{{
+		nil,
+		"id,price,price_currency,Name,tags_0,tags_1\n1,1.50,USD,a,2,3\n",
+	}, {
+		[]string{"tags_1", "price_currency", "Name"},
+		"tags_1,price_currency,Name\n3,USD,a\n",
+	}} {
+		var buf bytes.Buffer
+		e := NewEncoder(&buf).Opts(EncodeOpts{Columns: c.cols})
+		if err := e.EncodeNext(r); err != nil {
+			t.Errorf("EncodeNext(%v): %v", r, err)
+		} else if err := e.Flush(); err != nil {
+			t.Errorf("Flush(): %v", err)
+		} else if got := buf.String(); got != c.want {
+			t.Errorf("EncodeNext(%v) with columns %q: got %s, want %s", r, c.cols, got, c.want)
+		}
+	}
+
+	// Unknown columns are rejected for structs, and left empty for maps.
+	cols := []string{"id", "missing"}
+	if err := NewEncoder(&bytes.Buffer{}).Opts(EncodeOpts{Columns: cols}).EncodeNext(r); err == nil || !strings.Contains(err.Error(), `column "missing"`) {
+		t.Errorf("EncodeNext(%v): got %v, want unknown column error", r, err)
+	}
+	var buf bytes.Buffer
+	e := NewEncoder(&buf).Opts(EncodeOpts{Columns: cols})
+	for _, m := range []map[string]interface{}{{"id": 1, "other": 2}, {"missing": 3}} {
+		if err := e.EncodeNext(m); err != nil {
+			t.Errorf("EncodeNext(%v): %v", m, err)
+		}
+	}
+	if err := e.Flush(); err != nil {
+		t.Errorf("Flush(): %v", err)
+	}
+	if got, want := buf.String(), "id,missing\n1,\n,3\n"; got != want {
+		t.Errorf("EncodeNext(): got %s, want %s", got, want)
+	}
+}
+
+func TestEncode_MapKeys(t *testing.T) {
+	rows := []map[string]int{{"b": 1}, {"a": 2, "c": 3}, {}}
+	for _, c := range []struct {
+		opts EncodeOpts
+		want string
+		err  string
+	}{
+		{EncodeOpts{}, "b\n1\n", ""},
+		{EncodeOpts{UnionKeys: true}, "a,b,c\n,1,\n2,,3\n", ""},
+		{EncodeOpts{UnionKeys: true, Columns: []string{"c"}}, "c\n3\n", ""},
+		{EncodeOpts{StrictKeys: true}, "b\n1\n", `keys not in header row: "a", "c"`},
+		{EncodeOpts{UnionKeys: true, StrictKeys: true}, "a,b,c\n,1,\n2,,3\n", ""},
+	} {
+		var buf bytes.Buffer
+		err := NewTypedEncoder[map[string]int](&buf).Opts(c.opts).EncodeAll(rows)
+		if c.err == "" && err != nil {
+			t.Errorf("EncodeAll(%v) with %+v: %v", rows, c.opts, err)
+		} else if c.err != "" && (err == nil || err.Error() != c.err) {
+			t.Errorf("EncodeAll(%v) with %+v: got %v, want %q", rows, c.opts, err, c.err)
+		}
+		if got := buf.String(); got != c.want {
+			t.Errorf("EncodeAll(%v) with %+v: got %q, want %q", rows, c.opts, got, c.want)
+		}
+	}
+
+	// EncodeNext buffers maps until the first Flush.
+	var buf bytes.Buffer
+	e := NewEncoder(&buf).Opts(EncodeOpts{UnionKeys: true})
+	for _, m := range rows {
+		if err := e.EncodeNext(m); err != nil {
+			t.Errorf("EncodeNext(%v): %v", m, err)
+		}
+	}
+	if got := buf.String(); got != "" {
+		t.Errorf("EncodeNext(): got %q before Flush, want nothing", got)
+	}
+	if err := e.Flush(); err != nil {
+		t.Errorf("Flush(): %v", err)
+	}
+	// Later keys are left out.
+	if err := e.EncodeNext(map[string]int{"b": 4, "d": 5}); err != nil {
+		t.Errorf("EncodeNext(): %v", err)
+	}
+	if err := e.Close(); err != nil {
+		t.Errorf("Close(): %v", err)
+	}
+	if got, want := buf.String(), "a,b,c\n,1,\n2,,3\n,4,\n"; got != want {
+		t.Errorf("EncodeNext(): got %q, want %q", got, want)
+	}
+}
+
+func TestEncode_FlushClose(t *testing.T) {
+	type row struct{ A string }
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	if err := e.EncodeNext(row{"a"}); err != nil {
+		t.Fatalf("EncodeNext(): %v", err)
+	}
+	// Rows are buffered until flushed.
+	if got := buf.String(); got != "" {
+		t.Errorf("EncodeNext(): got %q before Flush, want nothing", got)
+	}
+	if err := e.Flush(); err != nil {
+		t.Errorf("Flush(): %v", err)
+	}
+	if got, want := buf.String(), "A\na\n"; got != want {
+		t.Errorf("Flush(): got %q, want %q", got, want)
+	}
+	if err := e.EncodeNext(row{"b"}); err != nil {
+		t.Fatalf("EncodeNext(): %v", err)
+	}
+	if err := e.Close(); err != nil {
+		t.Errorf("Close(): %v", err)
+	}
+	if got, want := buf.String(), "A\na\nb\n"; got != want {
+		t.Errorf("Close(): got %q, want %q", got, want)
+	}
+	if err := e.EncodeNext(row{"c"}); err == nil {
+		t.Errorf("EncodeNext() after Close: got nil, want error")
+	}
+	if err := e.Close(); err != nil {
+		t.Errorf("Close() twice: %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+package csvstruct
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DecodeError describes a failure to decode a single CSV cell.
+//
+// Use errors.As to retrieve a *DecodeError from errors returned by a
+// Decoder.
+type DecodeError struct {
+	Line   int    // line number of the row in the input, starting at 1
+	Column int    // column number of the cell in the row, starting at 1, or 0 if not a single cell
+	Header string // header of the cell's column
+	Field  string // name of the struct field being decoded, if any
+	Value  string // raw value of the cell
+	Err    error  // underlying error
+}
+
+func (e *DecodeError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("error decoding line %d, column %d (%q): %v", e.Line, e.Column, e.Header, e.Err)
+	}
+	return fmt.Sprintf("error decoding line %d, column %d (%q) into field %s: %v", e.Line, e.Column, e.Header, e.Field, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error { return e.Err }
+
+// DecodeErrors is a list of cell decoding failures, returned when
+// DecodeOpts.CollectErrors is set.
+//
+// Like the result of errors.Join, it can be inspected with errors.Is and
+// errors.As.
+type DecodeErrors []*DecodeError
+
+func (e DecodeErrors) Error() string {
+	s := make([]string, len(e))
+	for i, err := range e {
+		s[i] = err.Error()
+	}
+	return strings.Join(s, "\n")
+}
+
+func (e DecodeErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// HeaderError describes a header row that doesn't satisfy the struct being
+// decoded.
+type HeaderError struct {
+	Missing   []string // required columns that are missing
+	Unknown   []string // columns that don't map to any field, if DecodeOpts.StrictHeader is set
+	Ambiguous []string // columns that map to the same field, by its name or aliases, or that match the same name
+}
+
+func (e *HeaderError) Error() string {
+	var s []string
+	if len(e.Missing) != 0 {
+		s = append(s, fmt.Sprintf("missing required columns %s", quoteAll(e.Missing)))
+	}
+	if len(e.Unknown) != 0 {
+		s = append(s, fmt.Sprintf("unknown columns %s", quoteAll(e.Unknown)))
+	}
+	if len(e.Ambiguous) != 0 {
+		s = append(s, fmt.Sprintf("ambiguous columns %s", quoteAll(e.Ambiguous)))
+	}
+	return "invalid header row: " + strings.Join(s, "; ")
+}
+
+func quoteAll(s []string) string {
+	q := make([]string, len(s))
+	for i, v := range s {
+		q[i] = strconv.Quote(v)
+	}
+	return strings.Join(q, ", ")
+}
@@ -0,0 +1,136 @@
+package csvstruct
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDecodeError(t *testing.T) {
+	s := "Name,Age,IP\nAlice,25,128.0.0.1\nBob,old,128.0.0.1\nCarl,31,not-an-ip"
+	type row struct {
+		Name string
+		Age  int    `csv:"Age"`
+		Addr net.IP `csv:"IP"`
+	}
+	d := NewDecoder(strings.NewReader(s))
+	var r row
+	if err := d.DecodeNext(&r); err != nil {
+		t.Fatalf("DecodeNext(%q): %v", s, err)
+	}
+
+	err := d.DecodeNext(&r)
+	var de *DecodeError
+	if !errors.As(err, &de) {
+		t.Fatalf("DecodeNext(%q): got %v, want *DecodeError", s, err)
+	}
+	want := DecodeError{Line: 3, Column: 2, Header: "Age", Field: "Age", Value: "old", Err: de.Err}
+	if *de != want {
+		t.Errorf("DecodeNext(%q): got %+v, want %+v", s, *de, want)
+	}
+	if !errors.Is(err, strconv.ErrSyntax) {
+		t.Errorf("DecodeNext(%q): got %v, want strconv.ErrSyntax", s, err)
+	}
+
+	// TextUnmarshaler failures are reported as well.
+	err = d.DecodeNext(&r)
+	if !errors.As(err, &de) {
+		t.Fatalf("DecodeNext(%q): got %v, want *DecodeError", s, err)
+	}
+	want = DecodeError{Line: 4, Column: 3, Header: "IP", Field: "Addr", Value: "not-an-ip", Err: de.Err}
+	if *de != want {
+		t.Errorf("DecodeNext(%q): got %+v, want %+v", s, *de, want)
+	}
+}
+
+func TestDecodeError_Map(t *testing.T) {
+	s := "foo,bar\n1,x"
+	m := map[string]int{}
+	err := NewDecoder(strings.NewReader(s)).DecodeNext(&m)
+	var de *DecodeError
+	if !errors.As(err, &de) {
+		t.Fatalf("DecodeNext(%q): got %v, want *DecodeError", s, err)
+	}
+	want := DecodeError{Line: 2, Column: 2, Header: "bar", Value: "x", Err: de.Err}
+	if *de != want {
+		t.Errorf("DecodeNext(%q): got %+v, want %+v", s, *de, want)
+	}
+	if got, want := de.Error(), `error decoding line 2, column 2 ("bar"): strconv.ParseInt: parsing "x": invalid syntax`; got != want {
+		t.Errorf("Error(): got %q, want %q", got, want)
+	}
+}
+
+func TestDecodeErrors_Collect(t *testing.T) {
+	s := "A,B,C\n1,x,y\n2,3,4\nz,5,6"
+	type row struct{ A, B, C int }
+
+	// Every failing cell in a row is reported.
+	d := NewDecoder(strings.NewReader(s)).Opts(DecodeOpts{CollectErrors: true})
+	var r row
+	err := d.DecodeNext(&r)
+	var des DecodeErrors
+	if !errors.As(err, &des) {
+		t.Fatalf("DecodeNext(%q): got %v, want DecodeErrors", s, err)
+	}
+	var cols []int
+	for _, de := range des {
+		cols = append(cols, de.Column)
+	}
+	if !reflect.DeepEqual(cols, []int{2, 3}) {
+		t.Errorf("DecodeNext(%q): got errors in columns %v, want [2 3]", s, cols)
+	}
+	if want := (row{A: 1}); r != want {
+		t.Errorf("DecodeNext(%q): got %v, want %v", s, r, want)
+	}
+	var de *DecodeError
+	if !errors.As(err, &de) || de.Header != "B" {
+		t.Errorf("DecodeNext(%q): errors.As got %v, want error in column B", s, de)
+	}
+
+	// Decoding continues with the next row.
+	if err := d.DecodeNext(&r); err != nil {
+		t.Errorf("DecodeNext(%q): %v", s, err)
+	}
+	if want := (row{2, 3, 4}); r != want {
+		t.Errorf("DecodeNext(%q): got %v, want %v", s, r, want)
+	}
+
+	// DecodeAll reports every failing row, and returns the rest.
+	rows, err := NewTypedDecoder[row](strings.NewReader(s)).Opts(DecodeOpts{CollectErrors: true}).All()
+	if !errors.As(err, &des) {
+		t.Fatalf("DecodeAll(%q): got %v, want DecodeErrors", s, err)
+	}
+	var lines []int
+	for _, de := range des {
+		lines = append(lines, de.Line)
+	}
+	if !reflect.DeepEqual(lines, []int{2, 2, 4}) {
+		t.Errorf("DecodeAll(%q): got errors on lines %v, want [2 2 4]", s, lines)
+	}
+	if want := []row{{2, 3, 4}}; !reflect.DeepEqual(rows, want) {
+		t.Errorf("DecodeAll(%q): got %v, want %v", s, rows, want)
+	}
+}
+
+func TestDecodeErrors_CollectMap(t *testing.T) {
+	s := "a,b,c,d\nx,1,y,z"
+	m := map[string]int{}
+	err := NewDecoder(strings.NewReader(s)).Opts(DecodeOpts{CollectErrors: true}).DecodeNext(&m)
+	var des DecodeErrors
+	if !errors.As(err, &des) {
+		t.Fatalf("DecodeNext(%q): got %v, want DecodeErrors", s, err)
+	}
+	var headers []string
+	for _, de := range des {
+		headers = append(headers, de.Header)
+	}
+	if want := []string{"a", "c", "d"}; !reflect.DeepEqual(headers, want) {
+		t.Errorf("DecodeNext(%q): got errors in %v, want %v", s, headers, want)
+	}
+	if want := map[string]int{"b": 1}; !reflect.DeepEqual(m, want) {
+		t.Errorf("DecodeNext(%q): got %v, want %v", s, m, want)
+	}
+}
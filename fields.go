@@ -0,0 +1,721 @@
+package csvstruct
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// field describes how a single struct field maps to a CSV column.
+type field struct {
+	name       string   // column name
+	aliases    []string // alternate column names accepted when decoding
+	pos        int      // column index given by the tag, or -1
+	order      int      // position among encoded columns, if hasOrder
+	hasOrder   bool
+	fieldName  string // Go struct field name, qualified by any enclosing fields
+	index      []int  // index path, for fieldByIndex
+	typ        reflect.Type
+	tagged     bool // name was given in the struct tag
+	omitempty  bool
+	required   bool   // column must be present in the header row
+	conv       string // name of a registered converter, if any
+	marshal    bool   // type implements Marshaler
+	unmarshal  bool   // type implements Unmarshaler
+	expand     bool   // slice or array elements are in numbered columns
+	expandN    int    // number of expanded columns, or 0 if unknown
+	def        string // default cell value, if hasDef
+	hasDef     bool   // empty cells and a missing column decode as def
+	rules      []rule // built-in validation rules
+	validators string // names of custom validation rules, separated by '|'
+	opts       tagOptions
+	err        error // non-nil if the field's tag options are invalid
+
+	// decode and encode convert the field's value, or its elements if
+	// expand is set.
+	decode decodeFunc
+	encode encodeFunc
+}
+
+// decodeFunc parses s and stores the result in v, which must be settable.
+type decodeFunc func(v reflect.Value, s string) error
+
+// encodeFunc formats v as a CSV cell value.
+type encodeFunc func(v reflect.Value) (string, error)
+
+// fieldCache maps a struct's reflect.Type to its []field.
+var fieldCache sync.Map
+
+// cachedFields returns the fields of struct type t that map to CSV columns,
+// in declaration order.
+//
+// Fields are computed once per type and shared by all Decoders and Encoders.
+func cachedFields(t reflect.Type) []field {
+	if f, ok := fieldCache.Load(t); ok {
+		return f.([]field)
+	}
+	f, _ := fieldCache.LoadOrStore(t, typeFields(t))
+	return f.([]field)
+}
+
+// typeFields computes the fields of struct type t that map to CSV columns.
+//
+// Fields of embedded structs are promoted following the same rules as
+// encoding/json: if several fields share a column name, the least nested
+// one wins, then the one with a name given in its tag; otherwise all of them
+// are ignored. Fields tagged "inline" are flattened in the same way, with
+// their columns' names prefixed by the tag's "prefix" option, if any.
+func typeFields(t reflect.Type) []field {
+	var fields []field
+	appendFields(&fields, t, nil, "", "", map[reflect.Type]bool{t: true})
+
+	byName := map[string][]int{}
+	for i, f := range fields {
+		byName[f.name] = append(byName[f.name], i)
+	}
+	out := make([]field, 0, len(fields))
+	for i, f := range fields {
+		if dominantField(fields, byName[f.name]) == i {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// appendFields appends the fields of struct type t to fields, recursing into
+// embedded and inline structs.
+//
+// index, prefix and path are the index path, column name prefix and Go field
+// name prefix of t's fields. seen holds the struct types being walked, to
+// avoid infinite recursion.
+func appendFields(fields *[]field, t reflect.Type, index []int, prefix, path string, seen map[reflect.Type]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("csv")
+		if tag == "-" {
+			continue
+		}
+		name, opts := parseTag(tag)
+
+		ft := sf.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		isStruct := ft.Kind() == reflect.Struct && !isLeafType(ft)
+		if !sf.IsExported() {
+			// Fields of unexported embedded structs are promoted, unless
+			// the struct would have to be allocated.
+			if !sf.Anonymous || !isStruct || sf.Type.Kind() == reflect.Ptr {
+				continue
+			}
+		}
+
+		idx := append(index[:len(index):len(index)], i)
+		if isStruct && (sf.Anonymous && name == "" || opts.has("inline")) {
+			if seen[ft] {
+				continue
+			}
+			seen[ft] = true
+			p, _ := opts.get("prefix")
+			appendFields(fields, ft, idx, prefix+p, path+sf.Name+".", seen)
+			delete(seen, ft)
+			continue
+		}
+
+		var err error
+		f := field{
+			name:      prefix + sf.Name,
+			fieldName: path + sf.Name,
+			index:     idx,
+			typ:       sf.Type,
+			tagged:    name != "",
+			omitempty: opts.has("omitempty"),
+			required:  opts.has("required"),
+			opts:      opts,
+		}
+		f.conv, _ = opts.get("conv")
+		f.def, f.hasDef = opts.get("default")
+		f.validators, _ = opts.get("validate")
+		f.marshal = isMarshaler(f.typ)
+		f.unmarshal = isUnmarshaler(f.typ)
+		if name != "" {
+			f.name = prefix + name
+		}
+		f.pos, err = parsePosition(name, opts)
+		if o, ok := opts.get("order"); ok && err == nil {
+			f.hasOrder = true
+			if f.order, err = strconv.Atoi(o); err != nil {
+				err = fmt.Errorf("invalid order option %q", o)
+			}
+		}
+		if a, ok := opts.get("alias"); ok {
+			for _, alias := range strings.Split(a, "|") {
+				f.aliases = append(f.aliases, prefix+alias)
+			}
+		}
+		ct := f.typ // type converted by decode and encode
+		if err == nil {
+			f.expand, f.expandN, err = parseExpand(f.typ, opts)
+		}
+		if err == nil && f.expand {
+			ct = f.typ.Elem()
+		}
+		if err == nil && f.expand && f.pos >= 0 {
+			err = errors.New("index option is not supported for expanded fields")
+		}
+		if err == nil && f.hasDef && (f.expand || f.unmarshal) {
+			err = errors.New("default option is not supported for expanded or Unmarshaler fields")
+		}
+		if err == nil {
+			f.decode, err = newDecodeFunc(ct, opts, nil)
+		}
+		if err == nil {
+			f.encode, err = newEncodeFunc(ct, opts, nil)
+		}
+		if err == nil {
+			f.rules, err = parseRules(f.typ, opts)
+		}
+		f.err = err
+		*fields = append(*fields, f)
+	}
+}
+
+// dominantField returns the position in fields of the field that wins among
+// the candidates sharing a column name, or -1 if none does.
+func dominantField(fields []field, candidates []int) int {
+	if len(candidates) == 1 {
+		return candidates[0]
+	}
+	depth := len(fields[candidates[0]].index)
+	for _, c := range candidates[1:] {
+		if d := len(fields[c].index); d < depth {
+			depth = d
+		}
+	}
+	winner, n, tagged := -1, 0, 0
+	for _, c := range candidates {
+		if len(fields[c].index) != depth {
+			continue
+		}
+		n++
+		if fields[c].tagged {
+			tagged++
+			winner = c
+		} else if n == 1 {
+			winner = c
+		}
+	}
+	if n == 1 || tagged == 1 {
+		return winner
+	}
+	return -1
+}
+
+// isLeafType reports whether values of struct type t are converted as a
+// whole by one of the marshaling interfaces, rather than flattened into
+// their fields.
+func isLeafType(t reflect.Type) bool {
+	return t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textUnmarshalerType) ||
+		isMarshaler(t) || isUnmarshaler(t)
+}
+
+// tagOptions holds the comma-separated options following the column name in
+// a csv struct tag.
+type tagOptions []string
+
+// parseTag splits a csv struct tag into its column name and options.
+func parseTag(tag string) (string, tagOptions) {
+	if tag == "" {
+		return "", nil
+	}
+	parts := strings.Split(tag, ",")
+	return parts[0], tagOptions(parts[1:])
+}
+
+// has reports whether the option opt is set.
+func (o tagOptions) has(opt string) bool {
+	for _, v := range o {
+		if v == opt {
+			return true
+		}
+	}
+	return false
+}
+
+// get returns the value of the option "key=value".
+func (o tagOptions) get(key string) (string, bool) {
+	for _, v := range o {
+		if k, val, ok := strings.Cut(v, "="); ok && k == key {
+			return val, true
+		}
+	}
+	return "", false
+}
+
+// parsePosition returns the column index given by a tag's column name, if it's
+// of the form "#N", or by its "index" option, or -1 if neither is given.
+func parsePosition(name string, opts tagOptions) (int, error) {
+	s, ok := opts.get("index")
+	if n, isPos := strings.CutPrefix(name, "#"); isPos {
+		if ok {
+			return -1, errors.New("index option conflicts with column name " + name)
+		}
+		s, ok = n, true
+	}
+	if !ok {
+		return -1, nil
+	}
+	i, err := strconv.Atoi(s)
+	if err != nil || i < 0 {
+		return -1, fmt.Errorf("invalid column index %q", s)
+	}
+	return i, nil
+}
+
+// names returns the field's column name followed by its aliases.
+func (f *field) names() []string {
+	return append([]string{f.name}, f.aliases...)
+}
+
+// fieldByIndex returns the nested field of v with the given index path.
+//
+// Nil pointers to embedded or inline structs along the path are allocated if
+// alloc is true; otherwise the zero Value is returned.
+func fieldByIndex(v reflect.Value, index []int, alloc bool) reflect.Value {
+	if len(index) == 1 {
+		return v.Field(index[0])
+	}
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !alloc {
+					return reflect.Value{}
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// boundField is a field bound to the index of its column in the header row.
+type boundField struct {
+	*field
+	col  int
+	cols []int // column indexes of expanded elements
+
+	// decode and encode override the field's functions with the Format
+	// and any conversions registered with the Decoder or Encoder.
+	decode decodeFunc
+	encode encodeFunc
+
+	// rules are the field's built-in and custom validation rules, set only
+	// by a Decoder.
+	rules []rule
+}
+
+// structPlan is the result of binding a struct type to the header row.
+type structPlan struct {
+	fields []boundField
+	err    error // non-nil if the struct can't be bound to the header row
+}
+
+// columnIndex looks up the indexes of columns in the header row.
+type columnIndex interface {
+	// column returns the index of the named column, and whether the header
+	// row has such a column.
+	column(name string) (int, bool)
+
+	// position returns the index of the column at position i, given by a
+	// field's "index" option, and whether the header row has such a
+	// column.
+	position(i int) (int, bool)
+}
+
+// bindFields returns the fields of struct type t whose names are found in
+// idx, bound to their column indexes, using conversions registered in conv
+// and the cell format fm, which may be nil.
+//
+// A field with an "index" option is bound to the column at that position, if
+// idx has one. A field whose name isn't found is bound to the column of its
+// first alias that is.
+//
+// Fields that implement Marshaler or Unmarshaler, or that have a default, are
+// always bound, with a column index of -1 if their names aren't found.
+// Expanded fields are bound to the indexes of their numbered columns, with a
+// column index of -1.
+//
+// It returns an error if a field's default can't be decoded.
+func bindFields(t reflect.Type, idx columnIndex, conv *Converters, fm *Format) ([]boundField, error) {
+	if err := fm.validate(); err != nil {
+		return nil, err
+	}
+	fields := cachedFields(t)
+	p := make([]boundField, 0, len(fields))
+	for i := range fields {
+		f := &fields[i]
+		var col int
+		var cols []int
+		ok := false
+		if f.pos >= 0 {
+			col, ok = idx.position(f.pos)
+		}
+		for _, name := range f.names() {
+			if ok {
+				break
+			}
+			if f.expand {
+				cols = expandColumns(name, idx)
+				ok = len(cols) != 0
+			} else {
+				col, ok = idx.column(name)
+			}
+		}
+		if f.expand {
+			if !ok {
+				continue
+			}
+			col = -1
+		} else if !ok {
+			if !f.marshal && !f.unmarshal && !f.hasDef {
+				continue
+			}
+			col = -1
+		}
+		if f.err != nil {
+			return nil, fmt.Errorf("field %s: %w", f.fieldName, f.err)
+		}
+		bf := boundField{field: f, col: col, cols: cols, decode: f.decode, encode: f.encode}
+		ct := f.typ
+		if f.expand {
+			ct = ct.Elem()
+		}
+		var err error
+		if fm != nil {
+			if bf.decode, err = newDecodeFunc(ct, f.opts, fm); err != nil {
+				return nil, fmt.Errorf("field %s: %w", f.fieldName, err)
+			}
+			if bf.encode, err = newEncodeFunc(ct, f.opts, fm); err != nil {
+				return nil, fmt.Errorf("field %s: %w", f.fieldName, err)
+			}
+		}
+		dec, err := conv.decodeFunc(ct, f.conv, f.omitempty)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", f.fieldName, err)
+		} else if dec != nil {
+			bf.decode = dec
+		}
+		enc, err := conv.encodeFunc(ct, f.conv)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", f.fieldName, err)
+		} else if enc != nil {
+			bf.encode = enc
+		}
+		bf.decode, bf.encode = fm.decodeNull(bf.decode), fm.encodeNull(bf.encode)
+		if f.hasDef {
+			dec, def := bf.decode, f.def
+			if err := dec(reflect.New(ct).Elem(), def); err != nil {
+				return nil, fmt.Errorf("field %s: invalid default %q: %w", f.fieldName, def, err)
+			}
+			bf.decode = func(v reflect.Value, s string) error {
+				if s == "" {
+					s = def
+				}
+				return dec(v, s)
+			}
+		}
+		p = append(p, bf)
+	}
+	return p, nil
+}
+
+// newDecodeFunc returns a decodeFunc for values of type t, configured by the
+// struct tag options opts and the cell format fm, which may be nil.
+//
+// If opts has "omitempty", empty strings decode as zero values.
+func newDecodeFunc(t reflect.Type, opts tagOptions, fm *Format) (decodeFunc, error) {
+	dec, err := newValueDecodeFunc(t, opts, fm)
+	if err != nil {
+		return nil, err
+	}
+	if opts.has("omitempty") {
+		return func(v reflect.Value, s string) error {
+			if s == "" {
+				v.Set(reflect.Zero(v.Type()))
+				return nil
+			}
+			return dec(v, s)
+		}, nil
+	}
+	return dec, nil
+}
+
+func newValueDecodeFunc(t reflect.Type, opts tagOptions, fm *Format) (decodeFunc, error) {
+	switch t {
+	case timeType:
+		tf, err := parseTimeFormat(opts)
+		if err != nil {
+			return nil, err
+		} else if tf != nil {
+			return func(v reflect.Value, s string) error {
+				tm, err := tf.parse(s)
+				if err != nil {
+					return err
+				}
+				v.Set(reflect.ValueOf(tm))
+				return nil
+			}, nil
+		}
+	case durationType:
+		return func(v reflect.Value, s string) error {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return err
+			}
+			v.SetInt(int64(d))
+			return nil
+		}, nil
+	}
+
+	if t.Kind() == reflect.Ptr && isTimeType(t.Elem()) {
+		return newPtrDecodeFunc(t, opts, fm)
+	}
+	if t.Kind() != reflect.Ptr && reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return func(v reflect.Value, s string) error {
+			return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+		}, nil
+	}
+	if t.Implements(textUnmarshalerType) {
+		return func(v reflect.Value, s string) error {
+			if v.Kind() == reflect.Ptr && v.IsNil() {
+				v.Set(reflect.New(t.Elem()))
+			}
+			return v.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+		}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return newPtrDecodeFunc(t, opts, fm)
+	case reflect.String:
+		return func(v reflect.Value, s string) error {
+			v.SetString(s)
+			return nil
+		}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		bits := t.Bits()
+		return func(v reflect.Value, s string) error {
+			n, err := fm.parseNumber(s)
+			if err != nil {
+				return err
+			}
+			i, err := strconv.ParseInt(n, 10, bits)
+			if err != nil {
+				return err
+			}
+			v.SetInt(i)
+			return nil
+		}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		bits := t.Bits()
+		return func(v reflect.Value, s string) error {
+			n, err := fm.parseNumber(s)
+			if err != nil {
+				return err
+			}
+			u, err := strconv.ParseUint(n, 10, bits)
+			if err != nil {
+				return err
+			}
+			v.SetUint(u)
+			return nil
+		}, nil
+	case reflect.Float32, reflect.Float64:
+		bits := t.Bits()
+		return func(v reflect.Value, s string) error {
+			n, err := fm.parseNumber(s)
+			if err != nil {
+				return err
+			}
+			f, err := strconv.ParseFloat(n, bits)
+			if err != nil {
+				return err
+			}
+			v.SetFloat(f)
+			return nil
+		}, nil
+	case reflect.Complex64, reflect.Complex128:
+		bits := t.Bits()
+		return func(v reflect.Value, s string) error {
+			c, err := strconv.ParseComplex(s, bits)
+			if err != nil {
+				return err
+			}
+			v.SetComplex(c)
+			return nil
+		}, nil
+	case reflect.Slice, reflect.Array:
+		return newSliceDecodeFunc(t, opts, fm)
+	case reflect.Bool:
+		return func(v reflect.Value, s string) error {
+			b, err := fm.parseBool(s)
+			if err != nil {
+				return err
+			}
+			v.SetBool(b)
+			return nil
+		}, nil
+	default:
+		return func(v reflect.Value, s string) error {
+			return fmt.Errorf("can't decode type %v", t)
+		}, nil
+	}
+}
+
+// newPtrDecodeFunc returns a decodeFunc for pointer type t, which allocates
+// values as needed.
+func newPtrDecodeFunc(t reflect.Type, opts tagOptions, fm *Format) (decodeFunc, error) {
+	elem, err := newValueDecodeFunc(t.Elem(), opts, fm)
+	if err != nil {
+		return nil, err
+	}
+	return func(v reflect.Value, s string) error {
+		if v.IsNil() {
+			v.Set(reflect.New(t.Elem()))
+		}
+		return elem(v.Elem(), s)
+	}, nil
+}
+
+// errNoConversion is returned by builtinEncodeFunc for types it has no
+// conversion for.
+var errNoConversion = errors.New("no built-in conversion")
+
+// newEncodeFunc returns an encodeFunc for values of type t, configured by the
+// struct tag options opts and the cell format fm, which may be nil.
+//
+// Nil pointers are encoded as empty strings. Values of types without a
+// built-in conversion fail to encode.
+func newEncodeFunc(t reflect.Type, opts tagOptions, fm *Format) (encodeFunc, error) {
+	enc, err := builtinEncodeFunc(t, opts, fm)
+	if errors.Is(err, errNoConversion) {
+		return func(v reflect.Value) (string, error) {
+			if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Slice) && v.IsNil() {
+				return "", nil
+			}
+			return "", fmt.Errorf("can't encode type %v", t)
+		}, nil
+	}
+	return enc, err
+}
+
+// canEncode reports whether newEncodeFunc has a built-in conversion for values
+// of type t.
+func canEncode(t reflect.Type) bool {
+	_, err := builtinEncodeFunc(t, nil, nil)
+	return !errors.Is(err, errNoConversion)
+}
+
+// builtinEncodeFunc is like newEncodeFunc, but returns errNoConversion for
+// types without a built-in conversion.
+func builtinEncodeFunc(t reflect.Type, opts tagOptions, fm *Format) (encodeFunc, error) {
+	switch t {
+	case timeType:
+		tf, err := parseTimeFormat(opts)
+		if err != nil {
+			return nil, err
+		} else if tf != nil {
+			return func(v reflect.Value) (string, error) {
+				return tf.format(v.Interface().(time.Time)), nil
+			}, nil
+		}
+	case durationType:
+		return func(v reflect.Value) (string, error) {
+			return time.Duration(v.Int()).String(), nil
+		}, nil
+	}
+
+	if t.Kind() == reflect.Ptr && isTimeType(t.Elem()) {
+		return newPtrEncodeFunc(t, opts, fm)
+	}
+	if t.Implements(textMarshalerType) {
+		return func(v reflect.Value) (string, error) {
+			if v.Kind() == reflect.Ptr && v.IsNil() {
+				return "", nil
+			}
+			b, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+			if err != nil {
+				return "", err
+			}
+			return string(b), nil
+		}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return newPtrEncodeFunc(t, opts, fm)
+	case reflect.String:
+		return func(v reflect.Value) (string, error) {
+			return v.String(), nil
+		}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return func(v reflect.Value) (string, error) {
+			return fm.formatNumber(strconv.FormatInt(v.Int(), 10)), nil
+		}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return func(v reflect.Value) (string, error) {
+			return fm.formatNumber(strconv.FormatUint(v.Uint(), 10)), nil
+		}, nil
+	case reflect.Float32, reflect.Float64:
+		bits := t.Bits()
+		return func(v reflect.Value) (string, error) {
+			return fm.formatNumber(formatFloat(v.Float(), bits)), nil
+		}, nil
+	case reflect.Complex64, reflect.Complex128:
+		bits := t.Bits()
+		return func(v reflect.Value) (string, error) {
+			return strconv.FormatComplex(v.Complex(), 'g', -1, bits), nil
+		}, nil
+	case reflect.Slice, reflect.Array:
+		return newSliceEncodeFunc(t, opts, fm)
+	case reflect.Bool:
+		return func(v reflect.Value) (string, error) {
+			return fm.formatBool(v.Bool()), nil
+		}, nil
+	default:
+		return nil, errNoConversion
+	}
+}
+
+// newPtrEncodeFunc returns an encodeFunc for pointer type t.
+func newPtrEncodeFunc(t reflect.Type, opts tagOptions, fm *Format) (encodeFunc, error) {
+	elem, err := builtinEncodeFunc(t.Elem(), opts, fm)
+	if err != nil {
+		return nil, err
+	}
+	return func(v reflect.Value) (string, error) {
+		if v.IsNil() {
+			return "", nil
+		}
+		return elem(v.Elem())
+	}, nil
+}
+
+// formatFloat returns the shortest representation of f that parses back to
+// the same value with the given bit size, using an exponent only for very
+// large or small magnitudes.
+func formatFloat(f float64, bits int) string {
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	return strconv.FormatFloat(f, format, -1, bits)
+}
@@ -0,0 +1,137 @@
+package csvstruct
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCachedFields(t *testing.T) {
+	type row struct {
+		Foo        string `csv:"foo"`
+		Bar        *int   `csv:",omitempty"`
+		Ignored    string `csv:"-"`
+		unexported string
+	}
+	rt := reflect.TypeOf(row{})
+	fields := cachedFields(rt)
+	var got []string
+	for _, f := range fields {
+		got = append(got, f.name)
+	}
+	want := []string{"foo", "Bar"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("cachedFields(%v): got %v, want %v", rt, got, want)
+	}
+	if !fields[1].omitempty {
+		t.Errorf("cachedFields(%v): Bar should be omitempty", rt)
+	}
+	if again := cachedFields(rt); &again[0] != &fields[0] {
+		t.Errorf("cachedFields(%v): fields were recomputed", rt)
+	}
+}
+
+// Tests that Decoders and Encoders sharing cached fields can be used
+// concurrently.
+func TestCachedFields_Concurrent(t *testing.T) {
+	type row struct {
+		Foo string
+		Bar int
+	}
+	s := "Foo,Bar\na,1\nb,2\n"
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var rows []row
+			if err := DecodeAll(strings.NewReader(s), &rows); err != nil {
+				t.Errorf("DecodeAll(%q): %v", s, err)
+				return
+			}
+			var buf bytes.Buffer
+			if err := EncodeAll(&buf, rows); err != nil {
+				t.Errorf("EncodeAll(%v): %v", rows, err)
+				return
+			}
+			if got := buf.String(); got != s {
+				t.Errorf("EncodeAll(%v): got %s, want %s", rows, got, s)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestCachedFields_Embedded(t *testing.T) {
+	type Audit struct {
+		CreatedAt string
+		UpdatedBy string
+		ID        string // Shadowed by row.ID
+	}
+	type Address struct {
+		Street string
+		Zip    string `csv:"zip"`
+	}
+	type Named struct{ Name string }
+	type Other struct{ Name string }
+	type inner struct{ Hidden string }
+	type row struct {
+		ID string
+		Audit
+		*Named // Conflicts with Other.Name, so neither is used
+		Other
+		inner
+		Addr Address  `csv:"addr,inline,prefix=addr_"`
+		Home *Address `csv:",inline"`
+		Ship Address  // Not inline, so mapped to a single column
+	}
+	rt := reflect.TypeOf(row{})
+	var got []string
+	for _, f := range cachedFields(rt) {
+		got = append(got, f.name+"="+f.fieldName)
+	}
+	want := []string{
+		"ID=ID",
+		"CreatedAt=Audit.CreatedAt",
+		"UpdatedBy=Audit.UpdatedBy",
+		"Hidden=inner.Hidden",
+		"addr_Street=Addr.Street",
+		"addr_zip=Addr.Zip",
+		"Street=Home.Street",
+		"zip=Home.Zip",
+		"Ship=Ship",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("cachedFields(%v): got %v, want %v", rt, got, want)
+	}
+}
+
+func TestCachedFields_TaggedDominates(t *testing.T) {
+	type A struct {
+		X string `csv:"Name"`
+	}
+	type B struct {
+		Y string `csv:"Name"`
+	}
+	type C struct{ Name string }
+	type row struct {
+		A
+		C
+	}
+	rt := reflect.TypeOf(row{})
+	fields := cachedFields(rt)
+	if len(fields) != 1 || fields[0].fieldName != "A.X" {
+		t.Errorf("cachedFields(%v): got %v, want only A.X", rt, fields)
+	}
+
+	type row2 struct {
+		A
+		B
+	}
+	rt = reflect.TypeOf(row2{})
+	if fields := cachedFields(rt); len(fields) != 0 {
+		t.Errorf("cachedFields(%v): got %v, want none", rt, fields)
+	}
+}
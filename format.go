@@ -0,0 +1,202 @@
+package csvstruct
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Format specifies how booleans, nulls and numbers are represented in cells,
+// for data that doesn't follow the conventions of package strconv.
+//
+// The zero value uses the representations of package strconv and has no
+// null markers.
+type Format struct {
+	// True and False list the cell values of booleans, matched
+	// case-insensitively when decoding, such as "yes" and "no". The first
+	// of each is used when encoding. If both are empty, booleans are parsed
+	// with strconv.ParseBool and formatted with strconv.FormatBool.
+	True, False []string
+
+	// Null lists cell values, such as "NULL" or `\N`, that decode to the
+	// zero value, leaving pointers nil. When decoding into a
+	// map[string]interface{}, they decode to nil. The first is used when
+	// encoding nil pointers.
+	Null []string
+
+	// ThousandsSep, if set, separates groups of three digits in the integer
+	// part of numbers, such as ',' in "1,234.50". When decoding, numbers
+	// whose digits aren't grouped in threes are invalid.
+	ThousandsSep rune
+
+	// DecimalComma causes ',' to be used instead of '.' as the decimal
+	// separator of floating-point numbers, as in "1.234,50".
+	DecimalComma bool
+}
+
+// isZero reports whether fm is the zero Format.
+func (fm *Format) isZero() bool {
+	return len(fm.True) == 0 && len(fm.False) == 0 && len(fm.Null) == 0 &&
+		fm.ThousandsSep == 0 && !fm.DecimalComma
+}
+
+// validate returns an error if fm is ambiguous.
+func (fm *Format) validate() error {
+	if fm == nil {
+		return nil
+	}
+	if (len(fm.True) == 0) != (len(fm.False) == 0) {
+		return errors.New("format must set both True and False, or neither")
+	}
+	switch sep := fm.ThousandsSep; {
+	case sep == fm.decimalSep():
+		return errors.New("format thousands separator is the decimal separator")
+	case sep >= '0' && sep <= '9', sep == '+', sep == '-', sep == 'e', sep == 'E':
+		return errors.New("format thousands separator must not be part of a number")
+	}
+	return nil
+}
+
+// decimalSep returns the decimal separator of fm.
+func (fm *Format) decimalSep() rune {
+	if fm != nil && fm.DecimalComma {
+		return ','
+	}
+	return '.'
+}
+
+// isNull reports whether s is one of fm's null markers.
+func (fm *Format) isNull(s string) bool {
+	if fm == nil {
+		return false
+	}
+	for _, n := range fm.Null {
+		if s == n {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeNull returns a decodeFunc that sets values to zero for fm's null
+// markers, and otherwise calls dec.
+func (fm *Format) decodeNull(dec decodeFunc) decodeFunc {
+	if fm == nil || len(fm.Null) == 0 {
+		return dec
+	}
+	return func(v reflect.Value, s string) error {
+		if fm.isNull(s) {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		return dec(v, s)
+	}
+}
+
+// encodeNull returns an encodeFunc that formats nil pointers as fm's first
+// null marker, and otherwise calls enc.
+func (fm *Format) encodeNull(enc encodeFunc) encodeFunc {
+	if fm == nil || len(fm.Null) == 0 {
+		return enc
+	}
+	return func(v reflect.Value) (string, error) {
+		if v.Kind() == reflect.Ptr && v.IsNil() {
+			return fm.Null[0], nil
+		}
+		return enc(v)
+	}
+}
+
+// parseBool parses s as a boolean using fm's vocabulary.
+func (fm *Format) parseBool(s string) (bool, error) {
+	if fm == nil || len(fm.True) == 0 {
+		return strconv.ParseBool(s)
+	}
+	for _, t := range fm.True {
+		if strings.EqualFold(s, t) {
+			return true, nil
+		}
+	}
+	for _, f := range fm.False {
+		if strings.EqualFold(s, f) {
+			return false, nil
+		}
+	}
+	return false, &strconv.NumError{Func: "parseBool", Num: s, Err: strconv.ErrSyntax}
+}
+
+// formatBool formats b using fm's vocabulary.
+func (fm *Format) formatBool(b bool) string {
+	switch {
+	case fm == nil || len(fm.True) == 0:
+		return strconv.FormatBool(b)
+	case b:
+		return fm.True[0]
+	default:
+		return fm.False[0]
+	}
+}
+
+// parseNumber returns s with fm's thousands separators removed and its
+// decimal separator replaced by '.', ready to be parsed by package strconv.
+//
+// It returns an error if s's digits aren't grouped in threes, or if s has a
+// '.' that isn't a separator of fm.
+func (fm *Format) parseNumber(s string) (string, error) {
+	if fm == nil || (fm.ThousandsSep == 0 && !fm.DecimalComma) {
+		return s, nil
+	}
+	invalid := &strconv.NumError{Func: "parseNumber", Num: s, Err: strconv.ErrSyntax}
+	intPart, frac := s, ""
+	if i := strings.IndexRune(s, fm.decimalSep()); i >= 0 {
+		intPart, frac = s[:i], "."+s[i+1:]
+	}
+	if sep := fm.ThousandsSep; sep != 0 && strings.ContainsRune(intPart, sep) {
+		groups := strings.Split(intPart, string(sep))
+		if first := strings.TrimLeft(groups[0], "+-"); len(first) == 0 || len(first) > 3 {
+			return "", invalid
+		}
+		for _, g := range groups[1:] {
+			if len(g) != 3 {
+				return "", invalid
+			}
+		}
+		intPart = strings.Join(groups, "")
+	}
+	if fm.DecimalComma && strings.ContainsRune(intPart, '.') {
+		return "", invalid
+	}
+	return intPart + frac, nil
+}
+
+// formatNumber returns s, a number formatted by package strconv, with fm's
+// thousands separators and decimal separator.
+func (fm *Format) formatNumber(s string) string {
+	if fm == nil || (fm.ThousandsSep == 0 && !fm.DecimalComma) {
+		return s
+	}
+	start := 0
+	if start < len(s) && (s[0] == '-' || s[0] == '+') {
+		start = 1
+	}
+	end := start
+	for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+		end++
+	}
+	var b strings.Builder
+	b.WriteString(s[:start])
+	for i := start; i < end; i++ {
+		if i > start && (end-i)%3 == 0 && fm.ThousandsSep != 0 {
+			b.WriteRune(fm.ThousandsSep)
+		}
+		b.WriteByte(s[i])
+	}
+	rest := s[end:]
+	if strings.HasPrefix(rest, ".") {
+		b.WriteRune(fm.decimalSep())
+		rest = rest[1:]
+	}
+	b.WriteString(rest)
+	return b.String()
+}
@@ -0,0 +1,176 @@
+package csvstruct
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFormat_Decode(t *testing.T) {
+	type row struct {
+		Active bool      `csv:"active"`
+		Amount float64   `csv:"amount"`
+		Count  int       `csv:"count"`
+		Ptr    *int      `csv:"ptr"`
+		Name   string    `csv:"name"`
+		Rates  []float64 `csv:"rates,sep=;"`
+	}
+	for _, c := range []struct {
+		desc string
+		fm   Format
+		s    string
+		want []row
+	}{{
+		desc: "vocabulary",
+		fm:   Format{True: []string{"yes", "y", "on"}, False: []string{"no", "n", "off"}},
+		s:    "active\nYES\nn\nOn",
+		want: []row{{Active: true}, {Active: false}, {Active: true}},
+	}, {
+		desc: "nulls",
+		fm:   Format{Null: []string{"NULL", `\N`, "NA"}},
+		s:    "count,ptr,name\nNULL,\\N,NA\n3,4,bob",
+		want: []row{{}, {Count: 3, Ptr: intPtr(4), Name: "bob"}},
+	}, {
+		desc: "thousands separator",
+		fm:   Format{ThousandsSep: ','},
+		s:    "amount,count,ptr\n\"1,234.50\",\"-1,000,000\",12",
+		want: []row{{Amount: 1234.5, Count: -1000000, Ptr: intPtr(12)}},
+	}, {
+		desc: "decimal comma",
+		fm:   Format{ThousandsSep: '.', DecimalComma: true},
+		s:    "amount,rates\n\"1.234,50\",\"0,5;1.000\"",
+		want: []row{{Amount: 1234.5, Rates: []float64{0.5, 1000}}},
+	}} {
+		t.Run(c.desc, func(t *testing.T) {
+			rows, err := NewTypedDecoder[row](strings.NewReader(c.s)).Opts(DecodeOpts{Format: c.fm}).All()
+			if err != nil {
+				t.Fatalf("DecodeAll(%q): %v", c.s, err)
+			}
+			if !reflect.DeepEqual(rows, c.want) {
+				t.Errorf("DecodeAll(%q): got %+v, want %+v", c.s, rows, c.want)
+			}
+		})
+	}
+}
+
+func TestFormat_DecodeErrors(t *testing.T) {
+	type row struct {
+		Active bool    `csv:"active"`
+		Amount float64 `csv:"amount"`
+	}
+	for _, c := range []struct {
+		fm Format
+		s  string
+	}{
+		{Format{True: []string{"yes"}, False: []string{"no"}}, "active\ntrue"},
+		{Format{ThousandsSep: ','}, "amount\n\"1,23\""},
+		{Format{ThousandsSep: ','}, "amount\n\"1234,567\""},
+		{Format{ThousandsSep: ','}, "amount\n\",123\""},
+		{Format{DecimalComma: true}, "amount\n1.5"},
+		// Invalid formats.
+		{Format{True: []string{"yes"}}, "active\nyes"},
+		{Format{ThousandsSep: ',', DecimalComma: true}, "amount\n1"},
+		{Format{ThousandsSep: '.'}, "amount\n1"},
+	} {
+		var r row
+		if err := NewDecoder(strings.NewReader(c.s)).Opts(DecodeOpts{Format: c.fm}).DecodeNext(&r); err == nil {
+			t.Errorf("DecodeNext(%q) with %+v: expected error", c.s, c.fm)
+		}
+	}
+}
+
+func TestFormat_DecodeMap(t *testing.T) {
+	fm := Format{Null: []string{"NA"}, ThousandsSep: ','}
+	s := "a,b\nNA,\"1,234\""
+
+	var mi map[string]interface{}
+	if err := NewDecoder(strings.NewReader(s)).Opts(DecodeOpts{Format: fm}).DecodeNext(&mi); err != nil {
+		t.Fatalf("DecodeNext: %v", err)
+	}
+	if want := map[string]interface{}{"a": nil, "b": "1,234"}; !reflect.DeepEqual(mi, want) {
+		t.Errorf("DecodeNext: got %v, want %v", mi, want)
+	}
+
+	var mp map[string]*int
+	if err := NewDecoder(strings.NewReader(s)).Opts(DecodeOpts{Format: fm}).DecodeNext(&mp); err != nil {
+		t.Fatalf("DecodeNext: %v", err)
+	}
+	if want := map[string]*int{"a": nil, "b": intPtr(1234)}; !reflect.DeepEqual(mp, want) {
+		t.Errorf("DecodeNext: got %v, want %v", mp, want)
+	}
+}
+
+func TestFormat_Encode(t *testing.T) {
+	type row struct {
+		Active bool    `csv:"active"`
+		Amount float64 `csv:"amount"`
+		Count  uint    `csv:"count"`
+		Ptr    *int    `csv:"ptr"`
+	}
+	rows := []row{
+		{true, 1234.5, 1000000, intPtr(0)},
+		{false, -0.25, 12, intPtr(-1234)},
+	}
+	for _, c := range []struct {
+		desc string
+		fm   Format
+		want string
+	}{{
+		desc: "default",
+		want: "active,amount,count,ptr\ntrue,1234.5,1000000,0\nfalse,-0.25,12,-1234\n",
+	}, {
+		desc: "vocabulary",
+		fm:   Format{True: []string{"Y"}, False: []string{"N"}},
+		want: "active,amount,count,ptr\nY,1234.5,1000000,0\nN,-0.25,12,-1234\n",
+	}, {
+		desc: "thousands separator",
+		fm:   Format{ThousandsSep: ','},
+		want: "active,amount,count,ptr\ntrue,\"1,234.5\",\"1,000,000\",0\nfalse,-0.25,12,\"-1,234\"\n",
+	}, {
+		desc: "decimal comma",
+		fm:   Format{ThousandsSep: '.', DecimalComma: true},
+		want: "active,amount,count,ptr\ntrue,\"1.234,5\",1.000.000,0\nfalse,\"-0,25\",12,-1.234\n",
+	}} {
+		t.Run(c.desc, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := NewTypedEncoder[row](&buf).Opts(EncodeOpts{Format: c.fm}).EncodeAll(rows); err != nil {
+				t.Fatalf("EncodeAll: %v", err)
+			}
+			if got := buf.String(); got != c.want {
+				t.Errorf("EncodeAll: got %q, want %q", got, c.want)
+			}
+
+			// What's encoded decodes to the same values.
+			got, err := NewTypedDecoder[row](&buf).Opts(DecodeOpts{Format: c.fm}).All()
+			if err != nil {
+				t.Fatalf("DecodeAll: %v", err)
+			}
+			if !reflect.DeepEqual(got, rows) {
+				t.Errorf("DecodeAll: got %+v, want %+v", got, rows)
+			}
+		})
+	}
+}
+
+func TestFormat_EncodeNull(t *testing.T) {
+	type row struct {
+		A *int `csv:"a"`
+		B *int `csv:"b,omitempty"`
+		C int  `csv:"c"`
+	}
+	var buf bytes.Buffer
+	e := NewEncoder(&buf).Opts(EncodeOpts{Format: Format{Null: []string{`\N`, "NULL"}}})
+	if err := e.EncodeNext(row{}); err != nil {
+		t.Fatalf("EncodeNext: %v", err)
+	}
+	// Only nil pointers are null; omitempty takes precedence.
+	if err := e.Flush(); err != nil {
+		t.Errorf("Flush(): %v", err)
+	}
+	if got, want := buf.String(), "a,b,c\n\\N,,0\n"; got != want {
+		t.Errorf("EncodeNext: got %q, want %q", got, want)
+	}
+}
+
+func intPtr(i int) *int { return &i }
@@ -0,0 +1,151 @@
+package csvstruct
+
+import "reflect"
+
+var (
+	marshalerType   = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	unmarshalerType = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+)
+
+// Unmarshaler is implemented by types that can decode themselves from a CSV
+// row.
+//
+// Unlike encoding.TextUnmarshaler, an Unmarshaler has access to every cell in
+// the row, so it can be decoded from several columns.
+type Unmarshaler interface {
+	// UnmarshalCSV decodes the value of the field mapped to the column
+	// named field, from row.
+	//
+	// UnmarshalCSV is called for every row, even if the header row has no
+	// column named field.
+	UnmarshalCSV(field string, row Row) error
+}
+
+// ColumnUnmarshaler is implemented by Unmarshalers that read columns other
+// than the one named by their field, so that DecodeOpts.StrictHeader doesn't
+// report those columns as unknown.
+type ColumnUnmarshaler interface {
+	Unmarshaler
+
+	// UnmarshalColumns returns the names of the columns UnmarshalCSV reads
+	// for the field mapped to the column named field.
+	UnmarshalColumns(field string) []string
+}
+
+// Marshaler is implemented by types that can encode themselves into one or
+// more CSV cells.
+type Marshaler interface {
+	// MarshalCSV encodes the value of the field mapped to the column named
+	// field, as a Row of the columns it claims and their values.
+	//
+	// When a Marshaler is encoded in the first row, its columns are added
+	// to the header row in place of field.
+	MarshalCSV(field string) (Row, error)
+}
+
+// Row is a CSV row, whose cells can be looked up by column name.
+type Row struct {
+	columns []string
+	values  []string
+	index   map[string]int
+	key     func(string) string // maps column names to keys of index, if non-nil
+}
+
+// NewRow returns a Row with the given column names and cell values, which
+// must have the same length.
+func NewRow(columns, values []string) Row {
+	if len(columns) != len(values) {
+		panic("csvstruct: NewRow called with different numbers of columns and values")
+	}
+	return Row{columns: columns, values: values}
+}
+
+// Columns returns the names of the Row's columns.
+func (r Row) Columns() []string { return r.columns }
+
+// Values returns the Row's cell values, in the same order as its columns.
+func (r Row) Values() []string { return r.values }
+
+// Get returns the value of the cell in the named column, and whether the
+// Row has such a column.
+//
+// In a Row passed to UnmarshalCSV, column names are matched to the header row
+// according to DecodeOpts.HeaderMatch and DecodeOpts.NormalizeHeader.
+func (r Row) Get(column string) (string, bool) {
+	if r.index != nil {
+		if r.key != nil {
+			column = r.key(column)
+		}
+		i, ok := r.index[column]
+		if !ok {
+			return "", false
+		}
+		return r.values[i], true
+	}
+	for i, c := range r.columns {
+		if c == column {
+			return r.values[i], true
+		}
+	}
+	return "", false
+}
+
+// isMarshaler reports whether values of type t implement Marshaler.
+func isMarshaler(t reflect.Type) bool {
+	return t.Implements(marshalerType)
+}
+
+// isUnmarshaler reports whether pointers to values of type t implement
+// Unmarshaler.
+func isUnmarshaler(t reflect.Type) bool {
+	return t.Implements(unmarshalerType) || t.Kind() != reflect.Ptr && reflect.PtrTo(t).Implements(unmarshalerType)
+}
+
+// unmarshalCSV decodes row into v, which must be settable and implement
+// Unmarshaler itself or through a pointer.
+func unmarshalCSV(v reflect.Value, field string, row Row) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+	} else {
+		v = v.Addr()
+	}
+	return v.Interface().(Unmarshaler).UnmarshalCSV(field, row)
+}
+
+// marshalCSV encodes v, which must implement Marshaler. Nil pointers are
+// encoded as a Row with no columns.
+func marshalCSV(v reflect.Value, field string) (Row, error) {
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		return Row{}, nil
+	}
+	return v.Interface().(Marshaler).MarshalCSV(field)
+}
+
+// unmarshalColumns returns the columns declared by the Unmarshaler field f,
+// if its type implements ColumnUnmarshaler.
+func unmarshalColumns(f *field) []string {
+	t := f.typ
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if cu, ok := reflect.New(t).Interface().(ColumnUnmarshaler); ok {
+		return cu.UnmarshalColumns(f.name)
+	}
+	return nil
+}
+
+// marshalColumns returns the columns claimed by the Marshaler field f of
+// struct value rv, or by the zero value of f's type if it is unset.
+func marshalColumns(rv reflect.Value, f *field) ([]string, error) {
+	v := fieldByIndex(rv, f.index, false)
+	if !v.IsValid() || v.Kind() == reflect.Ptr && v.IsNil() {
+		v = reflect.New(f.typ).Elem()
+		if v.Kind() == reflect.Ptr {
+			v = reflect.New(f.typ.Elem())
+		}
+	}
+	r, err := v.Interface().(Marshaler).MarshalCSV(f.name)
+	return r.columns, err
+}
@@ -0,0 +1,158 @@
+package csvstruct
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// price is decoded from, and encoded to, an amount column and a currency
+// column.
+type price struct {
+	Amount   float64
+	Currency string
+}
+
+func (p *price) UnmarshalCSV(field string, row Row) error {
+	amount, _ := row.Get(field)
+	if amount == "" {
+		return nil
+	}
+	f, err := strconv.ParseFloat(amount, 64)
+	if err != nil {
+		return err
+	}
+	cur, ok := row.Get(field + "_currency")
+	if !ok {
+		return fmt.Errorf("missing column %s_currency", field)
+	}
+	*p = price{f, cur}
+	return nil
+}
+
+func (p price) MarshalCSV(field string) (Row, error) {
+	return NewRow(
+		[]string{field, field + "_currency"},
+		[]string{strconv.FormatFloat(p.Amount, 'f', 2, 64), p.Currency},
+	), nil
+}
+
+type priceRow struct {
+	Name  string
+	Price price   `csv:"price"`
+	Sale  *price  `csv:"sale"`
+	Note  *string `csv:",omitempty"`
+}
+
+func TestMarshaler_Decode(t *testing.T) {
+	s := "Name,price,price_currency,sale,sale_currency\na,1.50,USD,,\nb,2,EUR,1,EUR"
+	var rows []priceRow
+	if err := DecodeAll(strings.NewReader(s), &rows); err != nil {
+		t.Fatalf("DecodeAll(%q): %v", s, err)
+	}
+	want := []priceRow{
+		{"a", price{1.5, "USD"}, &price{}, nil},
+		{"b", price{2, "EUR"}, &price{1, "EUR"}, nil},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("DecodeAll(%q): got %+v, want %+v", s, rows, want)
+	}
+
+	// The claimed columns are known to StrictHeader.
+	d := NewDecoder(strings.NewReader(s)).Opts(DecodeOpts{StrictHeader: true})
+	var r priceRow
+	if err := d.DecodeNext(&r); err != nil {
+		t.Errorf("DecodeNext(%q): %v", s, err)
+	}
+
+	// Rows look up columns the way the Decoder matches them.
+	s = "NAME,Price,Price Currency\na,1.50,USD"
+	d = NewDecoder(strings.NewReader(s)).Opts(DecodeOpts{HeaderMatch: MatchLoose, StrictHeader: true})
+	if err := d.DecodeNext(&r); err != nil {
+		t.Errorf("DecodeNext(%q): %v", s, err)
+	} else if want := (priceRow{"a", price{1.5, "USD"}, &price{}, nil}); !reflect.DeepEqual(r, want) {
+		t.Errorf("DecodeNext(%q): got %+v, want %+v", s, r, want)
+	}
+
+	// Unmarshaler errors are reported as *DecodeError.
+	s = "Name,price\na,1"
+	err := NewDecoder(strings.NewReader(s)).DecodeNext(&r)
+	var de *DecodeError
+	if !errors.As(err, &de) || de.Field != "Price" || de.Line != 2 {
+		t.Errorf("DecodeNext(%q): got %v, want *DecodeError for Price on line 2", s, err)
+	}
+}
+
+// cost is only decoded, from an amount column and a currency column shared by
+// every field.
+type cost struct {
+	Amount   string
+	Currency string
+}
+
+func (m *cost) UnmarshalCSV(field string, row Row) error {
+	m.Amount, _ = row.Get("amount")
+	m.Currency, _ = row.Get("currency")
+	return nil
+}
+
+func (m *cost) UnmarshalColumns(field string) []string {
+	return []string{"amount", "currency"}
+}
+
+func TestColumnUnmarshaler(t *testing.T) {
+	type row struct {
+		Name  string
+		Price cost
+	}
+	s := "Name,amount,currency\na,1.50,USD"
+	var r row
+	if err := NewDecoder(strings.NewReader(s)).Opts(DecodeOpts{StrictHeader: true}).DecodeNext(&r); err != nil {
+		t.Fatalf("DecodeNext(%q): %v", s, err)
+	}
+	if want := (row{"a", cost{"1.50", "USD"}}); r != want {
+		t.Errorf("DecodeNext(%q): got %+v, want %+v", s, r, want)
+	}
+
+	// Other columns are still unknown.
+	s = "Name,amount,currency,tax\na,1.50,USD,0"
+	var herr *HeaderError
+	if err := NewDecoder(strings.NewReader(s)).Opts(DecodeOpts{StrictHeader: true}).DecodeNext(&r); !errors.As(err, &herr) || !reflect.DeepEqual(herr.Unknown, []string{"tax"}) {
+		t.Errorf("DecodeNext(%q): got %v, want unknown column tax", s, err)
+	}
+}
+
+func TestMarshaler_Encode(t *testing.T) {
+	in := []priceRow{
+		{"a", price{1.5, "USD"}, nil, nil},
+		{"b", price{2, "EUR"}, &price{1, "EUR"}, nil},
+	}
+	var buf bytes.Buffer
+	if err := EncodeAll(&buf, in); err != nil {
+		t.Fatalf("EncodeAll(%v): %v", in, err)
+	}
+	want := `Name,price,price_currency,sale,sale_currency,Note
+a,1.50,USD,,,
+b,2.00,EUR,1.00,EUR,
+`
+	if got := buf.String(); got != want {
+		t.Errorf("EncodeAll(%v): got %s, want %s", in, got, want)
+	}
+}
+
+func TestRow(t *testing.T) {
+	r := NewRow([]string{"a", "b"}, []string{"1", "2"})
+	if v, ok := r.Get("b"); !ok || v != "2" {
+		t.Errorf("Get(%q): got %q, %t", "b", v, ok)
+	}
+	if v, ok := r.Get("c"); ok {
+		t.Errorf("Get(%q): got %q, want missing", "c", v)
+	}
+	if !reflect.DeepEqual(r.Columns(), []string{"a", "b"}) || !reflect.DeepEqual(r.Values(), []string{"1", "2"}) {
+		t.Errorf("got %v, %v", r.Columns(), r.Values())
+	}
+}
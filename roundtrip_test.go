@@ -33,6 +33,9 @@ func TestRoundTrip(t *testing.T) {
 a,b,123,foo,128.0.0.1
 c,d,456,foo,128.0.0.1
 `
+	if err := e.Flush(); err != nil {
+		t.Errorf("Flush(): %v", err)
+	}
 	got := buf.String()
 	if got != want {
 		t.Errorf("unexpected result, got %s, want %s", got, want)
@@ -59,3 +62,61 @@ c,d,456,foo,128.0.0.1
 	}
 
 }
+
+func TestRoundTrip_Floats(t *testing.T) {
+	type row struct {
+		F32 float32
+		F64 float64
+	}
+	in := []row{{0.1, 0.1}, {1.0 / 3, 1.0 / 3}, {3.4e38, 1.7e308}, {-1e-40, 5e-324}}
+
+	var buf bytes.Buffer
+	if err := EncodeAll(&buf, in); err != nil {
+		t.Fatalf("EncodeAll(%v): %v", in, err)
+	}
+	var out []row
+	if err := DecodeAll(&buf, &out); err != nil {
+		t.Fatalf("DecodeAll: %v", err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("got unexpected result, got %v, want %v", out, in)
+	}
+}
+
+func TestRoundTrip_TagOptions(t *testing.T) {
+	type row struct {
+		Name    string   `csv:"name,omitempty"`
+		Count   int      `csv:"count,omitempty"`
+		Ratio   *float64 `csv:"ratio,omitempty"`
+		Ptr     *string  `csv:"ptr,omitempty"`
+		IP      *net.IP  `csv:"ip,omitempty"`
+		Ignored string   `csv:"-"`
+	}
+	s := "s"
+	f := 0.0
+	ip := net.IPv4(128, 0, 0, 1)
+	in := []row{
+		{"a", 1, &f, &s, &ip, ""},
+		{},
+	}
+
+	var buf bytes.Buffer
+	if err := EncodeAll(&buf, in); err != nil {
+		t.Fatalf("EncodeAll(%v): %v", in, err)
+	}
+	want := `name,count,ratio,ptr,ip
+a,1,0,s,128.0.0.1
+,,,,
+`
+	if got := buf.String(); got != want {
+		t.Errorf("unexpected result, got %s, want %s", got, want)
+	}
+
+	var out []row
+	if err := DecodeAll(&buf, &out); err != nil {
+		t.Fatalf("DecodeAll: %v", err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("got unexpected result, got %v, want %v", out, in)
+	}
+}
@@ -0,0 +1,180 @@
+package csvstruct
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// defaultSep separates the elements of a slice or array in a single cell,
+// unless the "sep" tag option specifies otherwise.
+const defaultSep = ","
+
+// isBytes reports whether t is a []byte, which is converted as the raw cell
+// value unless the "sep" tag option is set.
+func isBytes(t reflect.Type, opts tagOptions) bool {
+	_, ok := opts.get("sep")
+	return t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 && !ok
+}
+
+// newSliceDecodeFunc returns a decodeFunc for slice or array type t, which
+// splits the cell value into elements separated by the "sep" tag option.
+func newSliceDecodeFunc(t reflect.Type, opts tagOptions, fm *Format) (decodeFunc, error) {
+	if isBytes(t, opts) {
+		return func(v reflect.Value, s string) error {
+			v.SetBytes([]byte(s))
+			return nil
+		}, nil
+	}
+	sep, ok := opts.get("sep")
+	if !ok {
+		sep = defaultSep
+	}
+	elem, err := newValueDecodeFunc(t.Elem(), opts, fm)
+	if err != nil {
+		return nil, err
+	}
+	return func(v reflect.Value, s string) error {
+		v.Set(reflect.Zero(t))
+		if s == "" {
+			return nil
+		}
+		parts := strings.Split(s, sep)
+		if t.Kind() == reflect.Slice {
+			v.Set(reflect.MakeSlice(t, len(parts), len(parts)))
+		} else if len(parts) > t.Len() {
+			return fmt.Errorf("%d values don't fit in %v", len(parts), t)
+		}
+		for i, p := range parts {
+			if err := elem(v.Index(i), p); err != nil {
+				return fmt.Errorf("element %d: %w", i, err)
+			}
+		}
+		return nil
+	}, nil
+}
+
+// newSliceEncodeFunc returns an encodeFunc for slice or array type t, which
+// joins its elements into a single cell separated by the "sep" tag option.
+func newSliceEncodeFunc(t reflect.Type, opts tagOptions, fm *Format) (encodeFunc, error) {
+	if isBytes(t, opts) {
+		return func(v reflect.Value) (string, error) {
+			return string(v.Bytes()), nil
+		}, nil
+	}
+	sep, ok := opts.get("sep")
+	if !ok {
+		sep = defaultSep
+	}
+	elem, err := builtinEncodeFunc(t.Elem(), opts, fm)
+	if err != nil {
+		return nil, err
+	}
+	return func(v reflect.Value) (string, error) {
+		parts := make([]string, v.Len())
+		for i := range parts {
+			s, err := elem(v.Index(i))
+			if err != nil {
+				return "", fmt.Errorf("element %d: %w", i, err)
+			}
+			parts[i] = s
+		}
+		return strings.Join(parts, sep), nil
+	}, nil
+}
+
+// parseExpand returns whether the tag options opts specify that a field of
+// type t is expanded into numbered columns, and the number of columns if
+// given as "expand=N".
+//
+// An invalid option still reports the field as expanded, so that the error
+// is surfaced when its numbered columns are bound.
+func parseExpand(t reflect.Type, opts tagOptions) (bool, int, error) {
+	n := 0
+	if v, ok := opts.get("expand"); ok {
+		var err error
+		if n, err = strconv.Atoi(v); err != nil || n <= 0 {
+			return true, 0, fmt.Errorf("invalid expand option %q", v)
+		}
+	} else if !opts.has("expand") {
+		return false, 0, nil
+	}
+	switch t.Kind() {
+	case reflect.Slice:
+	case reflect.Array:
+		if n != 0 && n != t.Len() {
+			return true, 0, fmt.Errorf("expand=%d doesn't match length of %v", n, t)
+		}
+		n = t.Len()
+	default:
+		return true, 0, fmt.Errorf("expand option requires a slice or array, not %v", t)
+	}
+	return true, n, nil
+}
+
+// expandColumn returns the name of the i'th column of an expanded field.
+func expandColumn(name string, i int) string {
+	return name + "_" + strconv.Itoa(i)
+}
+
+// expandColumns returns the indexes in idx of the numbered columns of an
+// expanded field named name, stopping at the first missing column.
+func expandColumns(name string, idx columnIndex) []int {
+	var cols []int
+	for i := 0; ; i++ {
+		col, ok := idx.column(expandColumn(name, i))
+		if !ok {
+			return cols
+		}
+		cols = append(cols, col)
+	}
+}
+
+// decodeExpanded decodes the cells in columns cols of line into the
+// elements of v, which must be a settable slice or array, using elem.
+//
+// Empty cells leave their elements zero, and slices are truncated after the
+// last non-empty cell.
+func decodeExpanded(v reflect.Value, line []string, cols []int, elem decodeFunc) (int, error) {
+	n := len(cols)
+	if v.Kind() == reflect.Slice {
+		for n > 0 && line[cols[n-1]] == "" {
+			n--
+		}
+		v.Set(reflect.MakeSlice(v.Type(), n, n))
+	} else {
+		v.Set(reflect.Zero(v.Type()))
+		n = min(n, v.Len())
+	}
+	for i := 0; i < n; i++ {
+		if line[cols[i]] == "" {
+			continue
+		}
+		if err := elem(v.Index(i), line[cols[i]]); err != nil {
+			return cols[i], err
+		}
+	}
+	return -1, nil
+}
+
+// encodeExpanded encodes the elements of v, which must be a slice or array,
+// into the cells in columns cols of row, using elem.
+//
+// Elements whose columns are negative are left out.
+func encodeExpanded(v reflect.Value, row []string, cols []int, elem encodeFunc) error {
+	if v.Len() > len(cols) {
+		return fmt.Errorf("%d values don't fit in %d columns", v.Len(), len(cols))
+	}
+	for i := 0; i < v.Len(); i++ {
+		if cols[i] < 0 {
+			continue
+		}
+		s, err := elem(v.Index(i))
+		if err != nil {
+			return fmt.Errorf("element %d: %w", i, err)
+		}
+		row[cols[i]] = s
+	}
+	return nil
+}
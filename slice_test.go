@@ -0,0 +1,147 @@
+package csvstruct
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSlice_Decode(t *testing.T) {
+	type row struct {
+		Tags   []string    `csv:"tags,sep=|"`
+		Nums   []int       `csv:"nums"`
+		Arr    [3]float64  `csv:"arr,sep=;"`
+		IPs    []net.IP    `csv:"ips,sep= "`
+		Dates  []time.Time `csv:"dates,sep=|,layout=DateOnly"`
+		Bytes  []byte      `csv:"bytes"`
+		Codes  []int       `csv:"codes,expand"`
+		Points [2]int      `csv:"points,expand"`
+	}
+	s := `tags,nums,arr,ips,dates,bytes,codes_0,codes_1,codes_2,points_0,points_1
+a|b|c,"1,2",1.5;2,128.0.0.1 10.0.0.1,2014-06-01|2014-06-02,raw,7,8,,9,10
+,,,,,,,,,,`
+	var rows []row
+	if err := DecodeAll(strings.NewReader(s), &rows); err != nil {
+		t.Fatalf("DecodeAll(%q): %v", s, err)
+	}
+	want := []row{{
+		Tags:   []string{"a", "b", "c"},
+		Nums:   []int{1, 2},
+		Arr:    [3]float64{1.5, 2},
+		IPs:    []net.IP{ip, net.IPv4(10, 0, 0, 1)},
+		Dates:  []time.Time{time.Date(2014, 6, 1, 0, 0, 0, 0, time.UTC), time.Date(2014, 6, 2, 0, 0, 0, 0, time.UTC)},
+		Bytes:  []byte("raw"),
+		Codes:  []int{7, 8},
+		Points: [2]int{9, 10},
+	}, {
+		Bytes: []byte{},
+		Codes: []int{},
+	}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("DecodeAll(%q): got %+v, want %+v", s, rows, want)
+	}
+}
+
+func TestSlice_DecodeErrors(t *testing.T) {
+	type row struct {
+		Nums  []int  `csv:"nums,sep=|"`
+		Arr   [1]int `csv:"arr,sep=|"`
+		Codes []int  `csv:"codes,expand"`
+	}
+	for _, c := range []struct {
+		s      string
+		header string
+	}{
+		{"nums\n1|x", "nums"},
+		{"arr\n1|2", "arr"},
+		{"codes_0,codes_1\n1,x", "codes_1"},
+	} {
+		var r row
+		err := NewDecoder(strings.NewReader(c.s)).DecodeNext(&r)
+		var de *DecodeError
+		if !errors.As(err, &de) || de.Header != c.header {
+			t.Errorf("DecodeNext(%q): got %v, want *DecodeError in column %s", c.s, err, c.header)
+		}
+	}
+}
+
+func TestSlice_Encode(t *testing.T) {
+	type row struct {
+		Tags   []string   `csv:"tags,sep=|"`
+		Nums   []int      `csv:"nums"`
+		Arr    [2]float64 `csv:"arr,sep=;"`
+		Codes  []int      `csv:"codes,expand=3"`
+		Points [2]int     `csv:"points,expand"`
+		Extra  []string   `csv:"extra,expand"`
+	}
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	for _, r := range []row{
+		{[]string{"a", "b"}, []int{1, 2}, [2]float64{1.5, 2}, []int{7}, [2]int{9, 10}, []string{"x", "y"}},
+		{nil, nil, [2]float64{}, nil, [2]int{}, []string{"z"}},
+	} {
+		if err := e.EncodeNext(r); err != nil {
+			t.Errorf("EncodeNext(%v): %v", r, err)
+		}
+	}
+	want := `tags,nums,arr,codes_0,codes_1,codes_2,points_0,points_1,extra_0,extra_1
+a|b,"1,2",1.5;2,7,,,9,10,x,y
+,,0;0,,,,0,0,z,
+`
+	if err := e.Flush(); err != nil {
+		t.Errorf("Flush(): %v", err)
+	}
+	if got := buf.String(); got != want {
+		t.Errorf("EncodeNext(): got %s, want %s", got, want)
+	}
+
+	// Slices longer than the header fail.
+	if err := e.EncodeNext(row{Codes: []int{1, 2, 3, 4}}); err == nil {
+		t.Errorf("EncodeNext(): expected error encoding too many values")
+	}
+}
+
+func TestSlice_InvalidOptions(t *testing.T) {
+	for _, v := range []interface{}{
+		&struct {
+			A int `csv:",expand"`
+		}{},
+		&struct {
+			A []int `csv:",expand=x"`
+		}{},
+		&struct {
+			A [2]int `csv:",expand=3"`
+		}{},
+	} {
+		if err := NewDecoder(strings.NewReader("A_0\n1")).DecodeNext(v); err == nil {
+			t.Errorf("DecodeNext(%v): expected error", reflect.TypeOf(v).Elem())
+		}
+	}
+}
+
+func TestSlice_StrictHeader(t *testing.T) {
+	type row struct {
+		Codes []int `csv:"codes,expand,required"`
+	}
+	d := NewDecoder(strings.NewReader("codes_0,codes_1\n1,2")).Opts(DecodeOpts{StrictHeader: true})
+	var r row
+	if err := d.DecodeNext(&r); err != nil {
+		t.Errorf("DecodeNext: %v", err)
+	}
+	d = NewDecoder(strings.NewReader("codes,codes_x\n1,2")).Opts(DecodeOpts{StrictHeader: true})
+	err := d.DecodeNext(&r)
+	if want := `invalid header row: missing required columns "codes_0"; unknown columns "codes", "codes_x"`; err == nil || err.Error() != want {
+		t.Errorf("DecodeNext: got %v, want %s", err, want)
+	}
+
+	// Columns after a gap in the numbering aren't decoded, so they're unknown.
+	d = NewDecoder(strings.NewReader("codes_0,codes_2\n1,2")).Opts(DecodeOpts{StrictHeader: true})
+	err = d.DecodeNext(&r)
+	if want := `invalid header row: unknown columns "codes_2"`; err == nil || err.Error() != want {
+		t.Errorf("DecodeNext: got %v, want %s", err, want)
+	}
+}
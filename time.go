@@ -0,0 +1,145 @@
+package csvstruct
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// isTimeType reports whether t is time.Time or time.Duration, which are
+// converted according to their struct tag options.
+func isTimeType(t reflect.Type) bool {
+	return t == timeType || t == durationType
+}
+
+// timeLayouts maps the names of the layout constants in package time to
+// their values, for use in "layout" tag options.
+var timeLayouts = map[string]string{
+	"ANSIC":       time.ANSIC,
+	"UnixDate":    time.UnixDate,
+	"RubyDate":    time.RubyDate,
+	"RFC822":      time.RFC822,
+	"RFC822Z":     time.RFC822Z,
+	"RFC850":      time.RFC850,
+	"RFC1123":     time.RFC1123,
+	"RFC1123Z":    time.RFC1123Z,
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+	"Kitchen":     time.Kitchen,
+	"Stamp":       time.Stamp,
+	"StampMilli":  time.StampMilli,
+	"StampMicro":  time.StampMicro,
+	"StampNano":   time.StampNano,
+	"DateTime":    time.DateTime,
+	"DateOnly":    time.DateOnly,
+	"TimeOnly":    time.TimeOnly,
+}
+
+// timeUnits maps tag options for Unix timestamps to their units.
+var timeUnits = map[string]time.Duration{
+	"unix":      time.Second,
+	"unixmilli": time.Millisecond,
+	"unixmicro": time.Microsecond,
+	"unixnano":  time.Nanosecond,
+}
+
+// timeFormat describes how a time.Time is converted to and from a cell
+// value.
+type timeFormat struct {
+	layout string         // layout for time.Parse and time.Time.Format
+	unit   time.Duration  // unit of Unix timestamps, if layout is empty
+	loc    *time.Location // location of parsed and formatted times, or nil
+}
+
+// parseTimeFormat returns the timeFormat described by the struct tag options
+// opts, or nil if opts don't describe one.
+//
+// The "layout" option takes a layout string or the name of one of the layout
+// constants in package time, and defaults to RFC 3339. The options "unix",
+// "unixmilli", "unixmicro" and "unixnano" instead specify integer Unix
+// timestamps. The "tz" option takes a location name as understood by
+// time.LoadLocation.
+func parseTimeFormat(opts tagOptions) (*timeFormat, error) {
+	var tf timeFormat
+	set := false
+	if layout, ok := opts.get("layout"); ok {
+		if l, ok := timeLayouts[layout]; ok {
+			layout = l
+		}
+		tf.layout = layout
+		set = true
+	}
+	for opt, unit := range timeUnits {
+		if opts.has(opt) {
+			if set {
+				return nil, fmt.Errorf("conflicting time formats in tag options %q", opts)
+			}
+			tf.unit = unit
+			set = true
+		}
+	}
+	if tz, ok := opts.get("tz"); ok {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return nil, err
+		}
+		tf.loc = loc
+		set = true
+	}
+	if !set {
+		return nil, nil
+	}
+	if tf.layout == "" && tf.unit == 0 {
+		tf.layout = time.RFC3339Nano
+	}
+	return &tf, nil
+}
+
+func (tf *timeFormat) parse(s string) (time.Time, error) {
+	loc := tf.loc
+	if loc == nil {
+		loc = time.UTC
+	}
+	if tf.unit == 0 {
+		return time.ParseInLocation(tf.layout, s, loc)
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var t time.Time
+	switch tf.unit {
+	case time.Second:
+		t = time.Unix(n, 0)
+	case time.Millisecond:
+		t = time.UnixMilli(n)
+	case time.Microsecond:
+		t = time.UnixMicro(n)
+	default:
+		t = time.Unix(0, n)
+	}
+	return t.In(loc), nil
+}
+
+func (tf *timeFormat) format(t time.Time) string {
+	if tf.loc != nil {
+		t = t.In(tf.loc)
+	}
+	switch tf.unit {
+	case time.Second:
+		return strconv.FormatInt(t.Unix(), 10)
+	case time.Millisecond:
+		return strconv.FormatInt(t.UnixMilli(), 10)
+	case time.Microsecond:
+		return strconv.FormatInt(t.UnixMicro(), 10)
+	case time.Nanosecond:
+		return strconv.FormatInt(t.UnixNano(), 10)
+	}
+	return t.Format(tf.layout)
+}
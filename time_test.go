@@ -0,0 +1,100 @@
+package csvstruct
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTime_Decode(t *testing.T) {
+	type row struct {
+		Default time.Time
+		Layout  time.Time  `csv:",layout=01/02/2006 15:04"`
+		Named   time.Time  `csv:",layout=RFC1123"`
+		Zoned   time.Time  `csv:",layout=2006-01-02 15:04,tz=America/New_York"`
+		Unix    time.Time  `csv:",unix"`
+		Milli   *time.Time `csv:",unixmilli"`
+		Dur     time.Duration
+		DurPtr  *time.Duration `csv:",omitempty"`
+	}
+	s := `Default,Layout,Named,Zoned,Unix,Milli,Dur,DurPtr
+2014-06-01T12:00:00Z,06/01/2014 12:00,"Sun, 01 Jun 2014 12:00:00 UTC",2014-06-01 08:00,1401624000,1401624000000,1h30m,`
+	var r row
+	if err := NewDecoder(strings.NewReader(s)).DecodeNext(&r); err != nil {
+		t.Fatalf("DecodeNext(%q): %v", s, err)
+	}
+	want := time.Date(2014, 6, 1, 12, 0, 0, 0, time.UTC)
+	for name, got := range map[string]time.Time{
+		"Default": r.Default,
+		"Layout":  r.Layout,
+		"Named":   r.Named,
+		"Zoned":   r.Zoned,
+		"Unix":    r.Unix,
+		"Milli":   *r.Milli,
+	} {
+		if !got.Equal(want) {
+			t.Errorf("DecodeNext(%q): %s got %v, want %v", s, name, got, want)
+		}
+	}
+	if r.Zoned.Location().String() != "America/New_York" {
+		t.Errorf("DecodeNext(%q): Zoned got location %v", s, r.Zoned.Location())
+	}
+	if r.Dur != 90*time.Minute || r.DurPtr != nil {
+		t.Errorf("DecodeNext(%q): got durations %v, %v", s, r.Dur, r.DurPtr)
+	}
+}
+
+func TestTime_Encode(t *testing.T) {
+	type row struct {
+		Default time.Time
+		Layout  time.Time  `csv:",layout=01/02/2006 15:04"`
+		Zoned   time.Time  `csv:",layout=DateTime,tz=America/New_York"`
+		Unix    time.Time  `csv:",unix"`
+		Milli   *time.Time `csv:",unixmilli"`
+		Dur     time.Duration
+	}
+	ts := time.Date(2014, 6, 1, 12, 0, 0, 0, time.UTC)
+	r := row{ts, ts, ts, ts, &ts, 90 * time.Minute}
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	if err := e.EncodeNext(r); err != nil {
+		t.Fatalf("EncodeNext(%v): %v", r, err)
+	}
+	want := `Default,Layout,Zoned,Unix,Milli,Dur
+2014-06-01T12:00:00Z,06/01/2014 12:00,2014-06-01 08:00:00,1401624000,1401624000000,1h30m0s
+`
+	if err := e.Flush(); err != nil {
+		t.Errorf("Flush(): %v", err)
+	}
+	if got := buf.String(); got != want {
+		t.Errorf("EncodeNext(%v): got %s, want %s", r, got, want)
+	}
+
+	var out row
+	if err := NewDecoder(&buf).DecodeNext(&out); err != nil {
+		t.Fatalf("DecodeNext: %v", err)
+	}
+	if !out.Zoned.Equal(ts) || !out.Milli.Equal(ts) || out.Dur != r.Dur {
+		t.Errorf("DecodeNext: got %v, want %v", out, r)
+	}
+}
+
+func TestTime_InvalidOptions(t *testing.T) {
+	for _, v := range []interface{}{
+		&struct {
+			T time.Time `csv:",tz=Nowhere/Special"`
+		}{},
+		&struct {
+			T time.Time `csv:",unix,layout=DateOnly"`
+		}{},
+	} {
+		if err := NewDecoder(strings.NewReader("T\n1")).DecodeNext(v); err == nil {
+			t.Errorf("DecodeNext(%v): expected error", reflect.TypeOf(v).Elem())
+		}
+		if err := NewEncoder(&bytes.Buffer{}).EncodeNext(reflect.ValueOf(v).Elem().Interface()); err == nil {
+			t.Errorf("EncodeNext(%v): expected error", reflect.TypeOf(v).Elem())
+		}
+	}
+}
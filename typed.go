@@ -0,0 +1,179 @@
+package csvstruct
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"iter"
+	"reflect"
+)
+
+// TypedDecoder reads and decodes CSV rows of type T from an input stream.
+//
+// T must be a struct, a map with string keys, or a pointer to either.
+type TypedDecoder[T any] struct {
+	d *decoder
+}
+
+// NewTypedDecoder returns a TypedDecoder that reads rows of type T from r.
+func NewTypedDecoder[T any](r io.Reader) *TypedDecoder[T] {
+	return &TypedDecoder[T]{d: NewDecoder(r).(*decoder)}
+}
+
+// Opts specifies options to modify decoding behavior.
+//
+// It returns the TypedDecoder, to support chaining.
+func (d *TypedDecoder[T]) Opts(opts DecodeOpts) *TypedDecoder[T] {
+	d.d.Opts(opts)
+	return d
+}
+
+// Next returns the next row in the TypedDecoder's Reader.
+//
+// On the first call to Next, the first row in the reader will be used as the
+// header row, as with Decoder.DecodeNext. Next returns io.EOF when there are
+// no more rows.
+func (d *TypedDecoder[T]) Next() (T, error) {
+	line, err := d.d.read()
+	if errors.Is(err, io.EOF) {
+		if perr := d.checkEmpty(); perr != nil {
+			err = perr
+		}
+	}
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return d.decode(line)
+}
+
+// Rows returns an iterator over the remaining rows in the TypedDecoder's
+// Reader.
+//
+// Iteration stops at the end of the input, or after yielding an error that
+// isn't specific to a row, such as an error reading from the input or a
+// *HeaderError. Errors decoding a row are yielded as a *DecodeError, or as
+// DecodeErrors if DecodeOpts.CollectErrors is set, and rows with the wrong
+// number of fields as a *csv.ParseError wrapping csv.ErrFieldCount; after
+// these, iteration continues with the next row.
+func (d *TypedDecoder[T]) Rows() iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		for {
+			line, err := d.d.read()
+			if errors.Is(err, io.EOF) {
+				if err := d.checkEmpty(); err != nil {
+					var zero T
+					yield(zero, err)
+				}
+				return
+			} else if errors.Is(err, csv.ErrFieldCount) {
+				var zero T
+				if !yield(zero, err) {
+					return
+				}
+				continue
+			} else if err != nil {
+				var zero T
+				yield(zero, err)
+				return
+			}
+			v, err := d.decode(line)
+			if !yield(v, err) {
+				return
+			}
+			switch err.(type) {
+			case nil, *DecodeError, DecodeErrors:
+			default:
+				return
+			}
+		}
+	}
+}
+
+// Rows returns an iterator over the rows of type T read from r.
+//
+// It is shorthand for NewTypedDecoder[T](r).Rows().
+func Rows[T any](r io.Reader) iter.Seq2[T, error] {
+	return NewTypedDecoder[T](r).Rows()
+}
+
+// checkEmpty reports header errors for T if the input had no data rows, as
+// with Decoder.DecodeNext.
+func (d *TypedDecoder[T]) checkEmpty() error {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return d.d.checkEmpty(t)
+}
+
+func (d *TypedDecoder[T]) decode(line []string) (T, error) {
+	var v T
+	rv := reflect.ValueOf(&v).Elem()
+	if rv.Kind() == reflect.Ptr {
+		rv.Set(reflect.New(rv.Type().Elem()))
+		rv = rv.Elem()
+	}
+	if err := d.d.decodeValue(rv, line); err != nil {
+		var zero T
+		return zero, err
+	}
+	return v, nil
+}
+
+// All returns every remaining row in the TypedDecoder's Reader.
+//
+// Reaching the end of the input is not considered an error. If
+// DecodeOpts.CollectErrors is set, rows that fail to decode are left out, and
+// the failures of every row are returned together as DecodeErrors.
+func (d *TypedDecoder[T]) All() ([]T, error) {
+	var vs []T
+	err := d.d.decodeAll(&vs)
+	return vs, err
+}
+
+// TypedEncoder encodes and writes CSV rows of type T to an output stream.
+//
+// T must be a struct, a map with string keys, or a pointer to either.
+type TypedEncoder[T any] struct {
+	e *encoder
+}
+
+// NewTypedEncoder returns a TypedEncoder that writes rows of type T to w.
+func NewTypedEncoder[T any](w io.Writer) *TypedEncoder[T] {
+	return &TypedEncoder[T]{e: NewEncoder(w).(*encoder)}
+}
+
+// Opts specifies options to modify encoding behavior.
+//
+// It returns the TypedEncoder, to support chaining.
+func (e *TypedEncoder[T]) Opts(opts EncodeOpts) *TypedEncoder[T] {
+	e.e.Opts(opts)
+	return e
+}
+
+// Encode encodes v into a CSV row and writes it to the TypedEncoder's Writer,
+// as with Encoder.EncodeNext.
+//
+// Nil pointers are skipped.
+func (e *TypedEncoder[T]) Encode(v T) error {
+	return e.e.EncodeNext(v)
+}
+
+// EncodeAll encodes each element of vs, as with Encode, and flushes the
+// TypedEncoder's Writer before returning.
+func (e *TypedEncoder[T]) EncodeAll(vs []T) error {
+	return e.e.encodeAll(vs)
+}
+
+// Flush writes any buffered rows to the TypedEncoder's Writer, as with
+// Encoder.Flush.
+func (e *TypedEncoder[T]) Flush() error {
+	return e.e.Flush()
+}
+
+// Close flushes any buffered rows, after which encoding fails, as with
+// Encoder.Close.
+func (e *TypedEncoder[T]) Close() error {
+	return e.e.Close()
+}
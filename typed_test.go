@@ -0,0 +1,211 @@
+package csvstruct
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTypedDecoder(t *testing.T) {
+	type row struct {
+		Foo string
+		Bar int
+	}
+	s := "Foo,Bar\na,1\nb,2"
+	d := NewTypedDecoder[row](strings.NewReader(s))
+	var rows []row
+	for {
+		r, err := d.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Next(): %v", err)
+		}
+		rows = append(rows, r)
+	}
+	want := []row{{"a", 1}, {"b", 2}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("Next(): got %v, want %v", rows, want)
+	}
+
+	ptrs, err := NewTypedDecoder[*row](strings.NewReader(s)).All()
+	if err != nil {
+		t.Fatalf("All(): %v", err)
+	}
+	wantPtrs := []*row{{"a", 1}, {"b", 2}}
+	if !reflect.DeepEqual(ptrs, wantPtrs) {
+		t.Errorf("All(): got %v, want %v", ptrs, wantPtrs)
+	}
+
+	maps, err := NewTypedDecoder[map[string]string](strings.NewReader("Foo%Bar\na%1")).Opts(DecodeOpts{Comma: '%'}).All()
+	if err != nil {
+		t.Fatalf("All(): %v", err)
+	}
+	wantMaps := []map[string]string{{"Foo": "a", "Bar": "1"}}
+	if !reflect.DeepEqual(maps, wantMaps) {
+		t.Errorf("All(): got %v, want %v", maps, wantMaps)
+	}
+
+	if _, err := NewTypedDecoder[string](strings.NewReader(s)).Next(); err == nil {
+		t.Errorf("Next(): expected error decoding string")
+	}
+}
+
+func TestTypedEncoder(t *testing.T) {
+	type row struct {
+		Foo string
+		Bar int
+	}
+	var buf bytes.Buffer
+	e := NewTypedEncoder[*row](&buf).Opts(EncodeOpts{Comma: '%'})
+	for _, r := range []*row{{"a", 1}, nil, {"b", 2}} {
+		if err := e.Encode(r); err != nil {
+			t.Errorf("Encode(%v): %v", r, err)
+		}
+	}
+	if err := e.EncodeAll([]*row{{"c", 3}}); err != nil {
+		t.Errorf("EncodeAll(): %v", err)
+	}
+	want := `Foo%Bar
+a%1
+b%2
+c%3
+`
+	if got := buf.String(); got != want {
+		t.Errorf("Encode(): got %s, want %s", got, want)
+	}
+
+	// Nil interfaces are skipped, as with EncodeNext.
+	if err := NewTypedEncoder[any](&buf).Encode(nil); err != nil {
+		t.Errorf("Encode(nil): %v", err)
+	}
+}
+
+func TestRows(t *testing.T) {
+	type row struct {
+		Foo string
+		Bar int
+	}
+	s := "Foo,Bar\na,1\nb,oops\nc,3"
+	var rows []row
+	var errs []error
+	for r, err := range Rows[row](strings.NewReader(s)) {
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		rows = append(rows, r)
+	}
+	want := []row{{"a", 1}, {"c", 3}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("Rows(%q): got %v, want %v", s, rows, want)
+	}
+	if len(errs) != 1 {
+		t.Fatalf("Rows(%q): got errors %v, want 1", s, errs)
+	}
+	var de *DecodeError
+	if !errors.As(errs[0], &de) || de.Line != 3 {
+		t.Errorf("Rows(%q): got error %v, want *DecodeError on line 3", s, errs[0])
+	}
+
+	// Header errors stop iteration.
+	type required struct {
+		Baz string `csv:",required"`
+	}
+	errs = nil
+	for _, err := range Rows[required](strings.NewReader(s)) {
+		errs = append(errs, err)
+	}
+	var herr *HeaderError
+	if len(errs) != 1 || !errors.As(errs[0], &herr) {
+		t.Errorf("Rows(%q): got errors %v, want one *HeaderError", s, errs)
+	}
+
+	// Breaking out of the loop stops iteration.
+	n := 0
+	for range Rows[row](strings.NewReader(s)) {
+		n++
+		break
+	}
+	if n != 1 {
+		t.Errorf("Rows(%q): got %d iterations after break, want 1", s, n)
+	}
+
+	// Empty input yields nothing.
+	for r, err := range Rows[row](strings.NewReader("")) {
+		t.Errorf("Rows(%q): unexpected row %v, %v", "", r, err)
+	}
+
+	// Malformed input yields the error and stops.
+	errs = nil
+	for _, err := range Rows[row](strings.NewReader("Foo,Bar\na,\"1\"2\nb,2")) {
+		errs = append(errs, err)
+	}
+	if len(errs) != 1 || errs[0] == nil {
+		t.Errorf("Rows: got errors %v, want 1", errs)
+	}
+
+	// Rows with the wrong number of fields yield the error and continue.
+	s = "Foo,Bar\na,1,2\nb,2"
+	rows, errs = nil, nil
+	for r, err := range Rows[row](strings.NewReader(s)) {
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		rows = append(rows, r)
+	}
+	if len(errs) != 1 || !errors.Is(errs[0], csv.ErrFieldCount) {
+		t.Errorf("Rows(%q): got errors %v, want csv.ErrFieldCount", s, errs)
+	}
+	if want := []row{{"b", 2}}; !reflect.DeepEqual(rows, want) {
+		t.Errorf("Rows(%q): got %v, want %v", s, rows, want)
+	}
+}
+
+func ExampleRows() {
+	csv := `Name,Age
+Alice,25
+Bob,24`
+	type person struct {
+		Name string
+		Age  int
+	}
+	for p, err := range Rows[person](strings.NewReader(csv)) {
+		if err != nil {
+			panic(err)
+		}
+		fmt.Printf("%s is %d\n", p.Name, p.Age)
+	}
+	// Output:
+	// Alice is 25
+	// Bob is 24
+}
+
+func ExampleTypedDecoder_Next() {
+	csv := `Name,Age
+Alice,25
+Bob,24`
+	type person struct {
+		Name string
+		Age  int
+	}
+	d := NewTypedDecoder[person](strings.NewReader(csv))
+	for {
+		p, err := d.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			panic(err)
+		}
+		fmt.Printf("%s is %d\n", p.Name, p.Age)
+	}
+	// Output:
+	// Alice is 25
+	// Bob is 24
+}
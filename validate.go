@@ -0,0 +1,247 @@
+package csvstruct
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ValidateFunc checks a decoded field value, returning an error if it's
+// invalid.
+type ValidateFunc func(v interface{}) error
+
+// Validators holds custom validation rules, applied to fields tagged with
+// the option "validate=name". Several rules can be given as
+// "validate=name1|name2".
+//
+// The zero value is an empty set of rules, ready to use. A Validators may be
+// shared by Decoders, but must not be modified while in use.
+type Validators struct {
+	named map[string]ValidateFunc
+}
+
+// Register registers fn as the validation rule named name.
+func (vs *Validators) Register(name string, fn ValidateFunc) {
+	if vs.named == nil {
+		vs.named = make(map[string]ValidateFunc)
+	}
+	vs.named[name] = fn
+}
+
+// ValidationError describes a decoded value that fails a validation rule.
+//
+// A Decoder returns it as the Err of a *DecodeError, identifying the row and
+// column of the value.
+type ValidationError struct {
+	Rule string // rule that failed, such as "min=1" or "validate=name"
+	Err  error  // reason the value is invalid
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("failed validation %q: %v", e.Rule, e.Err)
+}
+
+func (e *ValidationError) Unwrap() error { return e.Err }
+
+// rule is a validation rule of a field.
+type rule struct {
+	name  string // tag option of the rule
+	check func(v reflect.Value) error
+}
+
+// validate applies rules to v, returning a *ValidationError for the first
+// that fails.
+func validate(rules []rule, v reflect.Value) error {
+	for _, r := range rules {
+		if err := r.check(v); err != nil {
+			return &ValidationError{Rule: r.name, Err: err}
+		}
+	}
+	return nil
+}
+
+// parseRules returns the built-in validation rules given by the tag options
+// opts for values of type t.
+//
+// Rules other than "notempty" pass for nil pointers.
+func parseRules(t reflect.Type, opts tagOptions) ([]rule, error) {
+	var rules []rule
+	if opts.has("notempty") {
+		rules = append(rules, rule{"notempty", func(v reflect.Value) error {
+			if v.IsZero() || hasLen(v.Kind()) && v.Len() == 0 {
+				return errors.New("value is empty")
+			}
+			return nil
+		}})
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	for _, key := range []string{"min", "max", "len", "oneof", "regex"} {
+		arg, ok := opts.get(key)
+		if !ok {
+			continue
+		}
+		check, err := newRuleCheck(t, key, arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s option %q: %w", key, arg, err)
+		}
+		rules = append(rules, rule{key + "=" + arg, func(v reflect.Value) error {
+			for v.Kind() == reflect.Ptr {
+				if v.IsNil() {
+					return nil
+				}
+				v = v.Elem()
+			}
+			return check(v)
+		}})
+	}
+	return rules, nil
+}
+
+// newRuleCheck returns a function that checks values of type t, which isn't
+// a pointer, against the built-in rule key with argument arg.
+func newRuleCheck(t reflect.Type, key, arg string) (func(reflect.Value) error, error) {
+	switch key {
+	case "min", "max", "len":
+		if hasLen(t.Kind()) {
+			n, err := strconv.Atoi(arg)
+			if err != nil {
+				return nil, err
+			}
+			return compareLen(key, n), nil
+		}
+		if key == "len" {
+			return nil, fmt.Errorf("not supported for type %v", t)
+		}
+		return newBoundCheck(t, key == "min", arg)
+	case "oneof":
+		dec, err := newValueDecodeFunc(t, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		if !t.Comparable() {
+			return nil, fmt.Errorf("not supported for type %v", t)
+		}
+		var allowed []reflect.Value
+		for _, s := range strings.Split(arg, "|") {
+			a := reflect.New(t).Elem()
+			if err := dec(a, s); err != nil {
+				return nil, err
+			}
+			allowed = append(allowed, a)
+		}
+		return func(v reflect.Value) error {
+			for _, a := range allowed {
+				if v.Equal(a) {
+					return nil
+				}
+			}
+			return fmt.Errorf("%v is not one of %s", v, strings.ReplaceAll(arg, "|", ", "))
+		}, nil
+	case "regex":
+		if t.Kind() != reflect.String {
+			return nil, fmt.Errorf("not supported for type %v", t)
+		}
+		re, err := regexp.Compile(arg)
+		if err != nil {
+			return nil, err
+		}
+		return func(v reflect.Value) error {
+			if !re.MatchString(v.String()) {
+				return fmt.Errorf("%q doesn't match %s", v.String(), arg)
+			}
+			return nil
+		}, nil
+	}
+	panic("unknown rule " + key)
+}
+
+// hasLen reports whether values of kind k have a length that "min", "max"
+// and "len" apply to.
+func hasLen(k reflect.Kind) bool {
+	switch k {
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		return true
+	}
+	return false
+}
+
+// compareLen returns a check that the length of a value, in characters for
+// strings, is at least, at most, or exactly n, for the rule key.
+func compareLen(key string, n int) func(reflect.Value) error {
+	return func(v reflect.Value) error {
+		l := 0
+		if v.Kind() == reflect.String {
+			l = utf8.RuneCountInString(v.String())
+		} else {
+			l = v.Len()
+		}
+		switch {
+		case key == "min" && l < n:
+			return fmt.Errorf("length %d is less than %d", l, n)
+		case key == "max" && l > n:
+			return fmt.Errorf("length %d is greater than %d", l, n)
+		case key == "len" && l != n:
+			return fmt.Errorf("length %d is not %d", l, n)
+		}
+		return nil
+	}
+}
+
+// newBoundCheck returns a check that numbers of type t are at least, if min
+// is set, or at most bound, which is parsed as a value of type t.
+func newBoundCheck(t reflect.Type, min bool, bound string) (func(reflect.Value) error, error) {
+	dec, err := newValueDecodeFunc(t, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	b := reflect.New(t).Elem()
+	if err := dec(b, bound); err != nil {
+		return nil, err
+	}
+	var order func(v reflect.Value) int
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		order = func(v reflect.Value) int { return cmp.Compare(v.Int(), b.Int()) }
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		order = func(v reflect.Value) int { return cmp.Compare(v.Uint(), b.Uint()) }
+	case reflect.Float32, reflect.Float64:
+		order = func(v reflect.Value) int { return cmp.Compare(v.Float(), b.Float()) }
+	default:
+		return nil, fmt.Errorf("not supported for type %v", t)
+	}
+	return func(v reflect.Value) error {
+		switch c := order(v); {
+		case min && c < 0:
+			return fmt.Errorf("%v is less than %v", v, b)
+		case !min && c > 0:
+			return fmt.Errorf("%v is greater than %v", v, b)
+		}
+		return nil
+	}, nil
+}
+
+// lookup returns the rules named by the tag option "validate=names", where
+// names are separated by '|'.
+func (vs *Validators) lookup(names string) ([]rule, error) {
+	var rules []rule
+	for _, name := range strings.Split(names, "|") {
+		var fn ValidateFunc
+		if vs != nil {
+			fn = vs.named[name]
+		}
+		if fn == nil {
+			return nil, fmt.Errorf("unknown validator %q", name)
+		}
+		rules = append(rules, rule{"validate=" + name, func(v reflect.Value) error {
+			return fn(v.Interface())
+		}})
+	}
+	return rules, nil
+}
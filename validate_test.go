@@ -0,0 +1,94 @@
+package csvstruct
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type validRow struct {
+	Name  string   `csv:",notempty,max=5"`
+	Age   int      `csv:",min=18,max=120"`
+	Code  string   `csv:",len=2,regex=^[A-Z]+$"`
+	Color string   `csv:",oneof=red|green|blue"`
+	Score *float64 `csv:",min=0.5"`
+	Tags  []string `csv:",sep=|,min=1"`
+}
+
+func TestValidate(t *testing.T) {
+	for _, c := range []struct {
+		row, rule string
+		col       int
+	}{
+		{"Ann,30,US,red,1,a", "", 0},
+		{",30,US,red,1,a", "notempty", 1},
+		{"Annabel,30,US,red,1,a", "max=5", 1},
+		{"Ann,17,US,red,1,a", "min=18", 2},
+		{"Ann,121,US,red,1,a", "max=120", 2},
+		{"Ann,30,USA,red,1,a", "len=2", 3},
+		{"Ann,30,us,red,1,a", "regex=^[A-Z]+$", 3},
+		{"Ann,30,US,pink,1,a", "oneof=red|green|blue", 4},
+		{"Ann,30,US,red,0.25,a", "min=0.5", 5},
+		{"Ann,30,US,red,1,", "min=1", 6},
+	} {
+		s := "Name,Age,Code,Color,Score,Tags\n" + c.row
+		var r validRow
+		err := NewDecoder(strings.NewReader(s)).DecodeNext(&r)
+		if c.rule == "" {
+			if err != nil {
+				t.Errorf("DecodeNext(%q): %v", s, err)
+			}
+			continue
+		}
+		var de *DecodeError
+		var ve *ValidationError
+		if !errors.As(err, &de) || !errors.As(err, &ve) {
+			t.Errorf("DecodeNext(%q): got %v, want *ValidationError", s, err)
+			continue
+		}
+		if ve.Rule != c.rule || de.Line != 2 || de.Column != c.col {
+			t.Errorf("DecodeNext(%q): got rule %q at line %d column %d, want %q at line 2 column %d", s, ve.Rule, de.Line, de.Column, c.rule, c.col)
+		}
+	}
+}
+
+func TestValidate_Custom(t *testing.T) {
+	errOdd := errors.New("odd")
+	var vs Validators
+	vs.Register("even", func(v interface{}) error {
+		if v.(int)%2 != 0 {
+			return errOdd
+		}
+		return nil
+	})
+	type row struct {
+		N int `csv:",validate=even"`
+	}
+	s := "N\n2\n3"
+	d := NewDecoder(strings.NewReader(s)).Opts(DecodeOpts{Validators: &vs})
+	var r row
+	if err := d.DecodeNext(&r); err != nil {
+		t.Fatalf("DecodeNext(%q): %v", s, err)
+	}
+	var ve *ValidationError
+	if err := d.DecodeNext(&r); !errors.As(err, &ve) || ve.Rule != "validate=even" || !errors.Is(err, errOdd) {
+		t.Errorf("DecodeNext(%q): got %v, want validate=even failure", s, err)
+	}
+
+	// Unregistered validators are reported before decoding any rows.
+	d = NewDecoder(strings.NewReader(s))
+	if err := d.DecodeNext(&r); err == nil || !strings.Contains(err.Error(), `unknown validator "even"`) {
+		t.Errorf("DecodeNext(%q): got %v, want unknown validator error", s, err)
+	}
+}
+
+func TestValidate_InvalidTag(t *testing.T) {
+	type row struct {
+		B bool `csv:",min=1"`
+	}
+	s := "B\ntrue"
+	var r row
+	if err := NewDecoder(strings.NewReader(s)).DecodeNext(&r); err == nil || !strings.Contains(err.Error(), "invalid min option") {
+		t.Errorf("DecodeNext(%q): got %v, want invalid min option error", s, err)
+	}
+}